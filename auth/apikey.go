@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+)
+
+// ApiKeyLookup returns the principal of an api key, or nil if the key is
+// unknown.
+type ApiKeyLookup func(ctx context.Context, key string) (*commonhttp.Principal, error)
+
+type apiKeyAuthenticator struct {
+	header string
+	lookup ApiKeyLookup
+}
+
+// NewApiKey creates an authenticator checking the api key of the header.
+func NewApiKey(header string, lookup ApiKeyLookup) Authenticator {
+	if lookup == nil {
+		panic("BUG: lookup must not be nil")
+	}
+	return &apiKeyAuthenticator{header: header, lookup: lookup}
+}
+
+func (a *apiKeyAuthenticator) Challenge() string {
+	return ""
+}
+
+func (a *apiKeyAuthenticator) Authenticate(request *http.Request) (*commonhttp.Principal, error) {
+	key := request.Header.Get(a.header)
+	if key == "" {
+		return nil, nil
+	}
+	principal, err := a.lookup(request.Context(), key)
+	if err != nil {
+		return nil, ErrInvalidCredentials.AddCause(err)
+	}
+	if principal == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if principal.Method == "" {
+		principal.Method = "api_key"
+	}
+	return principal, nil
+}
+
+// StaticApiKeys looks up the keys of a map from key to subject. The keys are
+// compared in constant time.
+func StaticApiKeys(keys map[string]string) ApiKeyLookup {
+	type entry struct {
+		hash    [sha256.Size]byte
+		subject string
+	}
+	entries := make([]entry, 0, len(keys))
+	for key, subject := range keys {
+		entries = append(entries, entry{hash: sha256.Sum256([]byte(key)), subject: subject})
+	}
+	return func(_ context.Context, key string) (*commonhttp.Principal, error) {
+		hash := sha256.Sum256([]byte(key))
+		subject := ""
+		for _, entry := range entries {
+			if subtle.ConstantTimeCompare(hash[:], entry.hash[:]) == 1 {
+				subject = entry.subject
+			}
+		}
+		if subject == "" {
+			return nil, nil
+		}
+		return &commonhttp.Principal{Subject: subject}, nil
+	}
+}
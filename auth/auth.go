@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+	commonhttp "github.com/thanhminhmr/go-common/http"
+	"github.com/thanhminhmr/go-common/tracing"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+const AuthenticatorsGroup = "authenticators"
+
+// ErrInvalidCredentials is returned by an Authenticator when the request
+// carries credentials of its kind that are not valid.
+const ErrInvalidCredentials = exception.String("Invalid credentials")
+
+// Authenticator verifies one kind of credentials.
+type Authenticator interface {
+	// Authenticate returns a nil principal without error when the request
+	// carries no credentials of its kind, so that the next authenticator is
+	// tried.
+	Authenticate(request *http.Request) (*commonhttp.Principal, error)
+	// Challenge returns the WWW-Authenticate value of the authenticator, or an
+	// empty string.
+	Challenge() string
+}
+
+type Config struct {
+	// jwt, enabled when a key source is configured
+	JwtAlgorithms       []string `env:"AUTH_JWT_ALGORITHMS" validate:"dive,oneof=HS256 HS384 HS512 RS256 RS384 RS512 PS256 PS384 PS512 ES256 ES384 ES512 EdDSA"`
+	JwtSecret           string   `env:"AUTH_JWT_SECRET" log:"redact"`
+	JwtPublicKeyFile    string   `env:"AUTH_JWT_PUBLIC_KEY_FILE" validate:"omitempty,file"`
+	JwtJwksFile         string   `env:"AUTH_JWT_JWKS_FILE" validate:"omitempty,file"`
+	JwtJwksUrl          string   `env:"AUTH_JWT_JWKS_URL" validate:"omitempty,url"`
+	JwtJwksCacheSeconds uint32   `env:"AUTH_JWT_JWKS_CACHE_SECONDS" validate:"min=1,max=86400"`
+	JwtIssuer           string   `env:"AUTH_JWT_ISSUER"`
+	JwtAudience         []string `env:"AUTH_JWT_AUDIENCE"`
+	JwtLeeway           uint32   `env:"AUTH_JWT_LEEWAY" validate:"min=0,max=600"`
+	JwtRequireExpiry    bool     `env:"AUTH_JWT_REQUIRE_EXPIRY"`
+	JwtScopesClaim      string   `env:"AUTH_JWT_SCOPES_CLAIM" validate:"required"`
+	JwtRolesClaim       string   `env:"AUTH_JWT_ROLES_CLAIM" validate:"required"`
+	// api keys as subject:key, enabled when any is configured
+	ApiKeyHeader string   `env:"AUTH_API_KEY_HEADER" validate:"required"`
+	ApiKeys      []string `env:"AUTH_API_KEYS" log:"redact"`
+	// basic auth users as username:bcrypt-hash, enabled when any is configured
+	BasicRealm string   `env:"AUTH_BASIC_REALM" validate:"required"`
+	BasicUsers []string `env:"AUTH_BASIC_USERS" log:"redact"`
+}
+
+func init() {
+	configuration.SetDefault("AUTH_JWT_ALGORITHMS", "RS256;ES256;EdDSA")
+	configuration.SetDefault("AUTH_JWT_JWKS_CACHE_SECONDS", "300")
+	configuration.SetDefault("AUTH_JWT_LEEWAY", "60")
+	configuration.SetDefault("AUTH_JWT_REQUIRE_EXPIRY", "true")
+	configuration.SetDefault("AUTH_JWT_SCOPES_CLAIM", "scope")
+	configuration.SetDefault("AUTH_JWT_ROLES_CLAIM", "roles")
+	configuration.SetDefault("AUTH_API_KEY_HEADER", "X-Api-Key")
+	configuration.SetDefault("AUTH_BASIC_REALM", "restricted")
+}
+
+type Params struct {
+	fx.In
+	Config         *Config
+	Authenticators []Authenticator `group:"authenticators"`
+}
+
+// New creates the authentication from the config, followed by the
+// authenticators of the group. Give its Handler to http.WithAuthentication.
+func New(params Params) (*Authentication, error) {
+	var authenticators []Authenticator
+	config := params.Config
+	if keys, err := configuredKeys(config); err != nil {
+		return nil, err
+	} else if keys != nil {
+		authenticators = append(authenticators, NewJwt(JwtOptions{
+			Keys:          keys,
+			Algorithms:    config.JwtAlgorithms,
+			Issuer:        config.JwtIssuer,
+			Audience:      config.JwtAudience,
+			Leeway:        time.Duration(config.JwtLeeway) * time.Second,
+			AllowNoExpiry: !config.JwtRequireExpiry,
+			ScopesClaim:   config.JwtScopesClaim,
+			RolesClaim:    config.JwtRolesClaim,
+		}))
+	}
+	if len(config.ApiKeys) > 0 {
+		keys := make(map[string]string, len(config.ApiKeys))
+		for _, entry := range config.ApiKeys {
+			subject, key, found := strings.Cut(entry, ":")
+			if !found || subject == "" || key == "" {
+				return nil, exception.String("Invalid api key, expecting subject:key")
+			}
+			keys[key] = subject
+		}
+		authenticators = append(authenticators, NewApiKey(config.ApiKeyHeader, StaticApiKeys(keys)))
+	}
+	if len(config.BasicUsers) > 0 {
+		users := make(map[string]string, len(config.BasicUsers))
+		for _, entry := range config.BasicUsers {
+			username, hash, found := strings.Cut(entry, ":")
+			if !found || username == "" || hash == "" {
+				return nil, exception.String("Invalid basic user, expecting username:hash")
+			}
+			users[username] = hash
+		}
+		authenticators = append(authenticators, NewBasic(config.BasicRealm, StaticBasicUsers(users)))
+	}
+	return NewAuthentication(append(authenticators, params.Authenticators...)...), nil
+}
+
+// configuredKeys returns the jwt keys from the config, or nil if there is none.
+func configuredKeys(config *Config) (Keys, error) {
+	var keys MultiKeys
+	if config.JwtSecret != "" {
+		keys = append(keys, StaticKeys{"": []byte(config.JwtSecret)})
+	}
+	if config.JwtPublicKeyFile != "" {
+		key, err := LoadPublicKeyFile(config.JwtPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, StaticKeys{"": key})
+	}
+	cacheDuration := time.Duration(config.JwtJwksCacheSeconds) * time.Second
+	if config.JwtJwksFile != "" {
+		keys = append(keys, NewJwksFile(config.JwtJwksFile, cacheDuration))
+	}
+	if config.JwtJwksUrl != "" {
+		keys = append(keys, NewJwksUrl(config.JwtJwksUrl, cacheDuration))
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+//region Authentication
+
+// Authentication tries its authenticators in order and puts the first
+// principal found in the request context. Anonymous requests are let through,
+// invalid credentials are answered with 401 Unauthorized.
+type Authentication struct {
+	authenticators []Authenticator
+	challenges     []string
+}
+
+func NewAuthentication(authenticators ...Authenticator) *Authentication {
+	authentication := &Authentication{authenticators: authenticators}
+	for _, authenticator := range authenticators {
+		if challenge := authenticator.Challenge(); challenge != "" {
+			authentication.challenges = append(authentication.challenges, challenge)
+		}
+	}
+	return authentication
+}
+
+// Challenges returns the WWW-Authenticate values of the authenticators.
+func (a *Authentication) Challenges() []string {
+	return a.challenges
+}
+
+func (a *Authentication) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := commonhttp.ContextWithChallenges(request.Context(), a.challenges)
+		request = request.WithContext(ctx)
+		for _, authenticator := range a.authenticators {
+			principal, err := authenticator.Authenticate(request)
+			if err != nil {
+				zerolog.Ctx(ctx).Debug().Err(err).Msg("Authentication failed")
+				a.unauthorized(writer, request)
+				return
+			}
+			if principal != nil {
+				tracing.SpanFromContext(ctx).SetAttribute("enduser.id", principal.Subject)
+				logger := zerolog.Ctx(ctx).With().Str("subject", principal.Subject).Logger()
+				ctx = commonhttp.ContextWithPrincipal(logger.WithContext(ctx), principal)
+				break
+			}
+		}
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+func (a *Authentication) unauthorized(writer http.ResponseWriter, request *http.Request) {
+	response := commonhttp.Unauthorized(request, ErrInvalidCredentials)
+	if err := response.Render(writer); err != nil {
+		zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render error")
+	}
+}
+
+//endregion Authentication
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicLookup returns the principal of a username and password, or nil if they
+// do not match.
+type BasicLookup func(ctx context.Context, username string, password string) (*commonhttp.Principal, error)
+
+type basicAuthenticator struct {
+	realm  string
+	lookup BasicLookup
+}
+
+// NewBasic creates an authenticator checking the basic credentials of the
+// Authorization header.
+func NewBasic(realm string, lookup BasicLookup) Authenticator {
+	if lookup == nil {
+		panic("BUG: lookup must not be nil")
+	}
+	return &basicAuthenticator{realm: realm, lookup: lookup}
+}
+
+func (a *basicAuthenticator) Challenge() string {
+	return "Basic realm=" + strconv.Quote(a.realm) + `, charset="UTF-8"`
+}
+
+func (a *basicAuthenticator) Authenticate(request *http.Request) (*commonhttp.Principal, error) {
+	username, password, found := request.BasicAuth()
+	if !found {
+		return nil, nil
+	}
+	principal, err := a.lookup(request.Context(), username, password)
+	if err != nil {
+		return nil, ErrInvalidCredentials.AddCause(err)
+	}
+	if principal == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if principal.Method == "" {
+		principal.Method = "basic"
+	}
+	return principal, nil
+}
+
+// dummyHash is compared for unknown users, so that they take as long as the
+// known ones.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	return hash
+})
+
+// StaticBasicUsers looks up the users of a map from username to bcrypt hash.
+func StaticBasicUsers(users map[string]string) BasicLookup {
+	return func(_ context.Context, username string, password string) (*commonhttp.Principal, error) {
+		hash, exists := users[username]
+		if !exists {
+			_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			return nil, nil
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return nil, nil
+		}
+		return &commonhttp.Principal{Subject: username}, nil
+	}
+}
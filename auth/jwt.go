@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+type JwtOptions struct {
+	Keys Keys
+	// Algorithms are the accepted signature algorithms, "none" is never
+	// accepted.
+	Algorithms []string
+	// Issuer is checked when not empty.
+	Issuer string
+	// Audience is checked when not empty, the token must have one of them.
+	Audience []string
+	// Leeway is the clock skew tolerated on exp and nbf.
+	Leeway time.Duration
+	// AllowNoExpiry accepts the tokens without exp, which never expire.
+	AllowNoExpiry bool
+	// ScopesClaim and RolesClaim are claims holding either a space separated
+	// string or an array of strings.
+	ScopesClaim string
+	RolesClaim  string
+}
+
+type jwtAuthenticator struct {
+	options JwtOptions
+}
+
+// NewJwt creates an authenticator verifying the bearer tokens of the
+// Authorization header.
+func NewJwt(options JwtOptions) Authenticator {
+	if options.Keys == nil {
+		panic("BUG: keys must not be nil")
+	}
+	if len(options.Algorithms) == 0 {
+		panic("BUG: algorithms must not be empty")
+	}
+	if options.ScopesClaim == "" {
+		options.ScopesClaim = "scope"
+	}
+	if options.RolesClaim == "" {
+		options.RolesClaim = "roles"
+	}
+	return &jwtAuthenticator{options: options}
+}
+
+func (a *jwtAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+func (a *jwtAuthenticator) Authenticate(request *http.Request) (*commonhttp.Principal, error) {
+	scheme, token, found := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	claims, err := a.verify(request.Context(), strings.TrimSpace(token))
+	if err != nil {
+		return nil, ErrInvalidCredentials.AddCause(err)
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, ErrInvalidCredentials.AddCause(exception.String("Token has no subject"))
+	}
+	return &commonhttp.Principal{
+		Subject: subject,
+		Method:  "jwt",
+		Scopes:  stringsClaim(claims[a.options.ScopesClaim]),
+		Roles:   stringsClaim(claims[a.options.RolesClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+func (a *jwtAuthenticator) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, exception.String("Token is malformed")
+	}
+	// header
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm == "" || !slices.Contains(a.options.Algorithms, header.Algorithm) {
+		return nil, exception.String("Token algorithm is not accepted: " + header.Algorithm)
+	}
+	// signature
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, exception.String("Token signature is malformed").AddCause(err)
+	}
+	key, err := a.options.Keys.Key(ctx, header.KeyID, header.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	// claims
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := a.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *jwtAuthenticator) verifyClaims(claims map[string]any) error {
+	now := time.Now()
+	if expiry, exists := claims["exp"].(float64); exists {
+		if now.After(time.Unix(int64(expiry), 0).Add(a.options.Leeway)) {
+			return exception.String("Token is expired")
+		}
+	} else if _, exists := claims["exp"]; exists {
+		return exception.String("Token expiry is malformed")
+	} else if !a.options.AllowNoExpiry {
+		return exception.String("Token has no expiry")
+	}
+	if notBefore, exists := claims["nbf"].(float64); exists {
+		if now.Add(a.options.Leeway).Before(time.Unix(int64(notBefore), 0)) {
+			return exception.String("Token is not valid yet")
+		}
+	}
+	if a.options.Issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != a.options.Issuer {
+			return exception.String("Token issuer is not accepted")
+		}
+	}
+	if len(a.options.Audience) > 0 {
+		accepted := false
+		for _, audience := range stringsClaim(claims["aud"]) {
+			if slices.Contains(a.options.Audience, audience) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return exception.String("Token audience is not accepted")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, output any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return exception.String("Token is malformed").AddCause(err)
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return exception.String("Token is malformed").AddCause(err)
+	}
+	return nil
+}
+
+// stringsClaim reads a claim holding a space separated string or an array.
+func stringsClaim(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		output := make([]string, 0, len(value))
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				output = append(output, text)
+			}
+		}
+		return output
+	default:
+		return nil
+	}
+}
+
+//region signatures
+
+const errKeyMismatch = exception.String("Key does not match the token algorithm")
+
+func signatureHash(algorithm string) crypto.Hash {
+	switch algorithm[len(algorithm)-3:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	default:
+		return crypto.SHA512
+	}
+}
+
+func verifySignature(algorithm string, key any, input string, signature []byte) error {
+	if algorithm == "EdDSA" {
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errKeyMismatch
+		}
+		if !ed25519.Verify(publicKey, []byte(input), signature) {
+			return exception.String("Token signature is invalid")
+		}
+		return nil
+	}
+	hash := signatureHash(algorithm)
+	switch algorithm[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return errKeyMismatch
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return exception.String("Token signature is invalid")
+		}
+		return nil
+	}
+	digest := hash.New()
+	digest.Write([]byte(input))
+	sum := digest.Sum(nil)
+	switch algorithm[:2] {
+	case "RS", "PS":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errKeyMismatch
+		}
+		var err error
+		if algorithm[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(publicKey, hash, sum, signature)
+		} else {
+			err = rsa.VerifyPSS(publicKey, hash, sum, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		}
+		if err != nil {
+			return exception.String("Token signature is invalid").AddCause(err)
+		}
+		return nil
+	case "ES":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errKeyMismatch
+		}
+		// ES512 uses P-521, the other curves match the hash size
+		bits := publicKey.Curve.Params().BitSize
+		if bits != hash.Size()*8 && (algorithm != "ES512" || bits != 521) {
+			return errKeyMismatch
+		}
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return exception.String("Token signature is invalid")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, sum, r, s) {
+			return exception.String("Token signature is invalid")
+		}
+		return nil
+	default:
+		return exception.String("Token algorithm is not supported: " + algorithm)
+	}
+}
+
+//endregion signatures
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeSegment(t *testing.T, value any) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signRs256(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]any{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	sum := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signHs256(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]any{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJwtVerify(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	valid := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{"sub": "user", "iss": "issuer", "aud": "audience", "exp": now + 60}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+		return claims
+	}
+	options := JwtOptions{
+		Keys:       StaticKeys{"": &privateKey.PublicKey},
+		Algorithms: []string{"RS256", "HS256", "none"},
+		Issuer:     "issuer",
+		Audience:   []string{"audience"},
+	}
+	tests := []struct {
+		name    string
+		token   string
+		options func(options *JwtOptions)
+		valid   bool
+	}{
+		{name: "valid", token: signRs256(t, privateKey, valid(nil)), valid: true},
+		{name: "audience array", token: signRs256(t, privateKey, valid(map[string]any{"aud": []string{"other", "audience"}})), valid: true},
+		{name: "hmac with the public key", token: signHs256(t, publicKeyDer, valid(nil))},
+		{name: "hmac with the public key as a static secret", token: signHs256(t, publicKeyDer, valid(nil)), options: func(options *JwtOptions) {
+			options.Keys = StaticKeys{"rsa": &privateKey.PublicKey, "": publicKeyDer}
+			options.Algorithms = []string{"RS256"}
+		}},
+		{name: "none", token: encodeSegment(t, map[string]any{"alg": "none"}) + "." + encodeSegment(t, valid(nil)) + "."},
+		{name: "tampered claims", token: func() string {
+			parts := strings.Split(signRs256(t, privateKey, valid(nil)), ".")
+			return parts[0] + "." + encodeSegment(t, valid(map[string]any{"sub": "admin"})) + "." + parts[2]
+		}()},
+		{name: "expired", token: signRs256(t, privateKey, valid(map[string]any{"exp": now - 120}))},
+		{name: "expired within leeway", token: signRs256(t, privateKey, valid(map[string]any{"exp": now - 30})), options: func(options *JwtOptions) {
+			options.Leeway = time.Minute
+		}, valid: true},
+		{name: "malformed expiry", token: signRs256(t, privateKey, valid(map[string]any{"exp": "tomorrow"}))},
+		{name: "no expiry", token: signRs256(t, privateKey, valid(map[string]any{"exp": nil}))},
+		{name: "no expiry allowed", token: signRs256(t, privateKey, valid(map[string]any{"exp": nil})), options: func(options *JwtOptions) {
+			options.AllowNoExpiry = true
+		}, valid: true},
+		{name: "not valid yet", token: signRs256(t, privateKey, valid(map[string]any{"nbf": now + 120}))},
+		{name: "wrong issuer", token: signRs256(t, privateKey, valid(map[string]any{"iss": "other"}))},
+		{name: "no issuer", token: signRs256(t, privateKey, valid(map[string]any{"iss": nil}))},
+		{name: "wrong audience", token: signRs256(t, privateKey, valid(map[string]any{"aud": "other"}))},
+		{name: "no audience", token: signRs256(t, privateKey, valid(map[string]any{"aud": nil}))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := options
+			if test.options != nil {
+				test.options(&options)
+			}
+			authenticator := NewJwt(options).(*jwtAuthenticator)
+			_, err := authenticator.verify(context.Background(), test.token)
+			if test.valid && err != nil {
+				t.Errorf("expected a valid token, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected an invalid token")
+			}
+		})
+	}
+}
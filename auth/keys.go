@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// Keys finds the key verifying a token, by key id and algorithm. The key is
+// a []byte for HMAC, or a *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey.
+type Keys interface {
+	Key(ctx context.Context, id string, algorithm string) (any, error)
+}
+
+const errKeyNotFound = exception.String("Key not found")
+
+// StaticKeys maps key ids to keys, the empty id matching any key id.
+type StaticKeys map[string]any
+
+func (k StaticKeys) Key(_ context.Context, id string, algorithm string) (any, error) {
+	if key, exists := k[id]; exists && keyMatches(algorithm, key) {
+		return key, nil
+	}
+	if key, exists := k[""]; exists && keyMatches(algorithm, key) {
+		return key, nil
+	}
+	return nil, errKeyNotFound
+}
+
+// keyMatches reports whether the type of the key fits the algorithm, so that
+// a public key is never used as an HMAC secret.
+func keyMatches(algorithm string, key any) bool {
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(algorithm, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(algorithm, "RS") || strings.HasPrefix(algorithm, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(algorithm, "ES")
+	case ed25519.PublicKey:
+		return algorithm == "EdDSA"
+	default:
+		return false
+	}
+}
+
+// MultiKeys tries each key source in order, the first key found wins.
+type MultiKeys []Keys
+
+func (k MultiKeys) Key(ctx context.Context, id string, algorithm string) (any, error) {
+	var errs []error
+	for _, keys := range k {
+		key, err := keys.Key(ctx, id, algorithm)
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errKeyNotFound.AddCause(errs...)
+}
+
+// LoadPublicKeyFile reads a PEM encoded public key or certificate.
+func LoadPublicKeyFile(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, exception.String("Read public key file failed").AddCause(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, exception.String("Public key file is not PEM encoded")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, exception.String("Parse certificate failed").AddCause(err)
+		}
+		return certificate.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, exception.String("Parse public key failed").AddCause(err)
+		}
+		return key, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, exception.String("Parse public key failed").AddCause(err)
+		}
+		return key, nil
+	}
+}
+
+//region Jwks
+
+// jwksMinRefresh limits the reloads triggered by unknown key ids.
+const jwksMinRefresh = 10 * time.Second
+
+// jwksLoadTimeout limits a reload, which is not canceled with the request
+// triggering it.
+const jwksLoadTimeout = 10 * time.Second
+
+// Jwks is a JSON Web Key Set, reloaded once the cache duration elapsed or when
+// a token refers to an unknown key id. The reloads run in the background, a
+// known key is returned without waiting for them. The last good keys are kept
+// when a reload fails.
+type Jwks struct {
+	load          func(ctx context.Context) ([]byte, error)
+	cacheDuration time.Duration
+	mutex         sync.Mutex
+	keys          map[string]jwk
+	loadErr       error
+	loadedAt      time.Time
+	attemptedAt   time.Time
+	// reloading is closed once the running reload is done, nil if none
+	reloading chan struct{}
+}
+
+type jwk struct {
+	key       any
+	algorithm string
+}
+
+func NewJwksFile(path string, cacheDuration time.Duration) *Jwks {
+	return &Jwks{
+		load: func(context.Context) ([]byte, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, exception.String("Read key set file failed").AddCause(err)
+			}
+			return data, nil
+		},
+		cacheDuration: cacheDuration,
+	}
+}
+
+func NewJwksUrl(url string, cacheDuration time.Duration) *Jwks {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Jwks{
+		load: func(ctx context.Context) ([]byte, error) {
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, exception.String("Create request failed").AddCause(err)
+			}
+			request.Header.Set("Accept", "application/json")
+			response, err := client.Do(request)
+			if err != nil {
+				return nil, exception.String("Fetch key set failed").AddCause(err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				return nil, exception.String("Key set responded with status " + response.Status)
+			}
+			return io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		},
+		cacheDuration: cacheDuration,
+	}
+}
+
+func (j *Jwks) Key(ctx context.Context, id string, algorithm string) (any, error) {
+	j.mutex.Lock()
+	now := time.Now()
+	key, found := j.find(id, algorithm)
+	if (now.Sub(j.loadedAt) > j.cacheDuration || !found) &&
+		now.Sub(j.attemptedAt) > jwksMinRefresh && j.reloading == nil {
+		j.attemptedAt = now
+		j.reloading = make(chan struct{})
+		go j.refresh(context.WithoutCancel(ctx), j.reloading)
+	}
+	reloading := j.reloading
+	j.mutex.Unlock()
+	if found {
+		return key, nil
+	}
+	// an unknown key id waits for the running reload
+	if reloading != nil {
+		select {
+		case <-reloading:
+		case <-ctx.Done():
+			return nil, exception.String("Load key set canceled").AddCause(ctx.Err())
+		}
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if key, found = j.find(id, algorithm); found {
+		return key, nil
+	}
+	if j.keys == nil && j.loadErr != nil {
+		return nil, j.loadErr
+	}
+	return nil, errKeyNotFound
+}
+
+// refresh reloads the key set outside the lock, then closes reloading.
+func (j *Jwks) refresh(ctx context.Context, reloading chan struct{}) {
+	ctx, cancel := context.WithTimeout(ctx, jwksLoadTimeout)
+	defer cancel()
+	keys, err := j.reload(ctx)
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to load key set")
+		j.loadErr = err
+	} else {
+		j.keys, j.loadErr, j.loadedAt = keys, nil, time.Now()
+	}
+	j.reloading = nil
+	close(reloading)
+}
+
+// find matches the key id, or the algorithm when the token has no key id.
+func (j *Jwks) find(id string, algorithm string) (any, bool) {
+	if id != "" {
+		found, exists := j.keys[id]
+		return found.key, exists && found.matches(algorithm)
+	}
+	for _, found := range j.keys {
+		if found.matches(algorithm) {
+			return found.key, true
+		}
+	}
+	return nil, false
+}
+
+func (k jwk) matches(algorithm string) bool {
+	return (k.algorithm == "" || k.algorithm == algorithm) && keyMatches(algorithm, k.key)
+}
+
+type jwkJson struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	K         string `json:"k"`
+}
+
+func (j *Jwks) reload(ctx context.Context) (map[string]jwk, error) {
+	data, err := j.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwkJson `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, exception.String("Decode key set failed").AddCause(err)
+	}
+	keys := make(map[string]jwk, len(set.Keys))
+	for index, parsed := range set.Keys {
+		if parsed.Use != "" && parsed.Use != "sig" {
+			continue
+		}
+		key, err := parsed.publicKey()
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("kid", parsed.KeyID).Msg("Ignored invalid key")
+			continue
+		}
+		id := parsed.KeyID
+		if id == "" {
+			id = "#" + strconv.Itoa(index)
+		}
+		keys[id] = jwk{key: key, algorithm: parsed.Algorithm}
+	}
+	return keys, nil
+}
+
+func (k jwkJson) publicKey() (any, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, exception.String("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, exception.String("Unsupported curve: " + k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, exception.String("Invalid EC key").AddCause(err)
+		}
+		return key, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, exception.String("Unsupported curve: " + k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, exception.String("Invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, exception.String("Invalid symmetric key")
+		}
+		return secret, nil
+	default:
+		return nil, exception.String("Unsupported key type: " + k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, exception.String("Invalid key parameter").AddCause(err)
+	}
+	if len(bytes) == 0 {
+		return nil, exception.String("Missing key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+//endregion Jwks
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJwksKey(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	keys := &Jwks{
+		load: func(ctx context.Context) ([]byte, error) {
+			loads.Add(1)
+			<-release
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return []byte(`{"keys":[{"kty":"oct","kid":"a","k":"` + base64.RawURLEncoding.EncodeToString([]byte("secret")) + `"}]}`), nil
+		},
+		cacheDuration: time.Hour,
+	}
+	// a canceled request neither waits nor cancels the reload
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := keys.Key(ctx, "a", "HS256"); err == nil {
+		t.Fatal("expected the canceled request to fail")
+	}
+	close(release)
+	if _, err := keys.Key(context.Background(), "a", "HS256"); err != nil {
+		t.Fatalf("expected the reloaded key, got %v", err)
+	}
+	// a known stale key does not wait for the reload
+	keys.mutex.Lock()
+	keys.loadedAt = time.Now().Add(-2 * time.Hour)
+	keys.attemptedAt = time.Time{}
+	keys.mutex.Unlock()
+	if _, err := keys.Key(context.Background(), "a", "HS256"); err != nil {
+		t.Fatalf("expected the stale key, got %v", err)
+	}
+	// unknown key ids are rate limited
+	for range 3 {
+		if _, err := keys.Key(context.Background(), "unknown", "HS256"); err == nil {
+			t.Fatal("expected an unknown key")
+		}
+	}
+	if count := loads.Load(); count != 2 {
+		t.Fatalf("expected 2 loads, got %d", count)
+	}
+}
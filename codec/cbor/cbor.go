@@ -0,0 +1,32 @@
+// Package cbor registers the CBOR codec to the http package when imported.
+package cbor
+
+import (
+	"io"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func init() {
+	commonhttp.RegisterCodec(Codec{})
+}
+
+type Codec struct{}
+
+func (Codec) MediaTypes() []string {
+	return []string{"application/cbor"}
+}
+
+func (Codec) Suffix() string {
+	return "cbor"
+}
+
+func (Codec) Decode(reader io.Reader, value any) error {
+	return cbor.NewDecoder(reader).Decode(value)
+}
+
+func (Codec) Encode(writer io.Writer, value any) error {
+	return cbor.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,33 @@
+// Package msgpack registers the MessagePack codec to the http package when
+// imported.
+package msgpack
+
+import (
+	"io"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func init() {
+	commonhttp.RegisterCodec(Codec{})
+}
+
+type Codec struct{}
+
+func (Codec) MediaTypes() []string {
+	return []string{"application/vnd.msgpack", "application/msgpack", "application/x-msgpack"}
+}
+
+func (Codec) Suffix() string {
+	return ""
+}
+
+func (Codec) Decode(reader io.Reader, value any) error {
+	return msgpack.NewDecoder(reader).Decode(value)
+}
+
+func (Codec) Encode(writer io.Writer, value any) error {
+	return msgpack.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,53 @@
+// Package protobuf registers the Protocol Buffers codec to the http package
+// when imported. The values must be generated messages.
+package protobuf
+
+import (
+	"io"
+
+	commonhttp "github.com/thanhminhmr/go-common/http"
+
+	"github.com/thanhminhmr/go-exception"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	commonhttp.RegisterCodec(Codec{})
+}
+
+const ErrNotMessage = exception.String("Value is not a protobuf message")
+
+type Codec struct{}
+
+func (Codec) MediaTypes() []string {
+	return []string{"application/protobuf", "application/x-protobuf", "application/vnd.google.protobuf"}
+}
+
+func (Codec) Suffix() string {
+	return "proto"
+}
+
+func (Codec) Decode(reader io.Reader, value any) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return ErrNotMessage
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return exception.String("Read message failed").AddCause(err)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+func (Codec) Encode(writer io.Writer, value any) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return ErrNotMessage
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return exception.String("Marshal message failed").AddCause(err)
+	}
+	_, err = writer.Write(data)
+	return err
+}
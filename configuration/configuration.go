@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/thanhminhmr/go-common/internal"
+	"github.com/thanhminhmr/go-common/validation"
 
 	"github.com/go-viper/mapstructure/v2"
 )
@@ -54,7 +55,7 @@ func Load[T any](config *T, prefixes ...string) error {
 	if err := decoder.Decode(getEnvironment(prefix)); err != nil {
 		return err
 	}
-	return internal.Validator.Struct(config)
+	return validation.Struct(config)
 }
 
 func Loader[T any](config *T, prefixes ...string) func() (*T, error) {
@@ -0,0 +1,27 @@
+package configuration
+
+import (
+	"strings"
+
+	"github.com/thanhminhmr/go-common/internal"
+)
+
+var sensitiveKeyParts = []string{"PASSWORD", "SECRET", "TOKEN", "PRIVATE_KEY", "API_KEY", "CREDENTIAL"}
+
+// Dump returns the config as a map keyed by environment names, suitable for
+// logging. Fields tagged `log:"-"` are omitted, fields tagged `log:"redact"`
+// and fields whose key looks like a secret are redacted.
+func Dump[T any](config *T) map[string]any {
+	dumped, _ := internal.Redact(config, "env", isSensitiveKey).(map[string]any)
+	return dumped
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
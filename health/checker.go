@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// CheckersGroup is the fx value group collecting every registered Checker.
+const CheckersGroup = "health_checkers"
+
+type Probe uint
+
+const (
+	ProbeLiveness Probe = 1 << iota
+	ProbeReadiness
+
+	ProbeAll = ProbeLiveness | ProbeReadiness
+)
+
+// Checker is a single named health check. A zero Probe means the check is only
+// reported by the health route, a zero Timeout means the configured default.
+type Checker struct {
+	Name    string
+	Probe   Probe
+	Timeout time.Duration
+	Check   func(ctx context.Context) error
+}
+
+// AsChecker annotates a constructor so that its result is added to the
+// checkers group.
+func AsChecker(constructor any) any {
+	return fx.Annotate(constructor, fx.ResultTags(`group:"`+CheckersGroup+`"`))
+}
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping creates a readiness checker from anything that can be pinged, such as a
+// *pgxpool.Pool.
+func Ping(name string, pinger Pinger) Checker {
+	return Checker{
+		Name:  name,
+		Probe: ProbeReadiness,
+		Check: pinger.Ping,
+	}
+}
@@ -0,0 +1,199 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+type Config struct {
+	HealthPath    string `env:"HEALTH_PATH" validate:"required,startswith=/"`
+	LivenessPath  string `env:"HEALTH_LIVENESS_PATH" validate:"required,startswith=/"`
+	ReadinessPath string `env:"HEALTH_READINESS_PATH" validate:"required,startswith=/"`
+	CheckTimeout  uint32 `env:"HEALTH_CHECK_TIMEOUT" validate:"min=1,max=60"`
+	CacheDuration uint32 `env:"HEALTH_CACHE_DURATION" validate:"min=0,max=3600"`
+	DrainDelay    uint32 `env:"HEALTH_DRAIN_DELAY" validate:"min=0,max=300"`
+}
+
+func init() {
+	configuration.SetDefault("HEALTH_PATH", "/healthz")
+	configuration.SetDefault("HEALTH_LIVENESS_PATH", "/livez")
+	configuration.SetDefault("HEALTH_READINESS_PATH", "/readyz")
+	configuration.SetDefault("HEALTH_CHECK_TIMEOUT", "5")
+	configuration.SetDefault("HEALTH_CACHE_DURATION", "1")
+	configuration.SetDefault("HEALTH_DRAIN_DELAY", "0")
+}
+
+type Params struct {
+	fx.In
+	Context   context.Context
+	Lifecycle fx.Lifecycle
+	Config    *Config
+	Router    chi.Router
+	Checkers  []Checker `group:"health_checkers"`
+}
+
+// Register mounts the health, liveness and readiness routes on the router.
+// Readiness starts failing as soon as the OnStop hook begins, then waits for
+// the configured drain delay before letting the other hooks stop.
+func Register(params Params) {
+	health := &healthHandler{
+		ctx:      params.Context,
+		timeout:  time.Duration(params.Config.CheckTimeout) * time.Second,
+		cache:    time.Duration(params.Config.CacheDuration) * time.Second,
+		drain:    time.Duration(params.Config.DrainDelay) * time.Second,
+		checkers: make([]*cachedChecker, 0, len(params.Checkers)),
+	}
+	for _, checker := range params.Checkers {
+		if checker.Name == "" || checker.Check == nil {
+			panic("BUG: health checker must have a name and a check function")
+		}
+		health.checkers = append(health.checkers, &cachedChecker{Checker: checker})
+	}
+	params.Router.Get(params.Config.HealthPath, health.handler(0))
+	params.Router.Get(params.Config.LivenessPath, health.handler(ProbeLiveness))
+	params.Router.Get(params.Config.ReadinessPath, health.handler(ProbeReadiness))
+	params.Lifecycle.Append(fx.Hook{
+		OnStop: health.onStop,
+	})
+}
+
+type healthHandler struct {
+	ctx      context.Context
+	timeout  time.Duration
+	cache    time.Duration
+	drain    time.Duration
+	checkers []*cachedChecker
+	draining atomic.Bool
+}
+
+func (h *healthHandler) onStop(ctx context.Context) error {
+	h.draining.Store(true)
+	logger := zerolog.Ctx(h.ctx)
+	logger.Info().Dur("drain_delay", h.drain).Msg("Readiness is now failing")
+	if h.drain > 0 {
+		timer := time.NewTimer(h.drain)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+type Status string
+
+const (
+	StatusPass     Status = "pass"
+	StatusFail     Status = "fail"
+	StatusDraining Status = "draining"
+)
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func (h *healthHandler) handler(probe Probe) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		report := h.run(request.Context(), probe)
+		status := http.StatusOK
+		if report.Status != StatusPass {
+			status = http.StatusServiceUnavailable
+		}
+		header := writer.Header()
+		header.Set("Content-Type", "application/json; charset=utf-8")
+		header.Set("Cache-Control", "no-store")
+		writer.WriteHeader(status)
+		if err := json.NewEncoder(writer).Encode(report); err != nil {
+			zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render health report")
+		}
+	}
+}
+
+func (h *healthHandler) run(ctx context.Context, probe Probe) Report {
+	report := Report{Status: StatusPass, Checks: map[string]CheckResult{}}
+	if probe&ProbeReadiness != 0 && h.draining.Load() {
+		report.Status = StatusDraining
+	}
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	for _, checker := range h.checkers {
+		if probe != 0 && checker.Probe&probe == 0 {
+			continue
+		}
+		waitGroup.Go(func() {
+			result := checker.run(ctx, h.timeout, h.cache)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[checker.Name] = result
+			if result.Status != StatusPass && report.Status == StatusPass {
+				report.Status = StatusFail
+			}
+		})
+	}
+	waitGroup.Wait()
+	return report
+}
+
+type cachedChecker struct {
+	Checker
+	mutex  sync.Mutex
+	result CheckResult
+	expiry time.Time
+}
+
+func (c *cachedChecker) run(ctx context.Context, timeout time.Duration, cache time.Duration) CheckResult {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if now.Before(c.expiry) {
+		return c.result
+	}
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	// the result is cached for the other callers, so a caller going away must
+	// not cancel the check
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	err := c.safeCheck(ctx)
+	c.result = CheckResult{
+		Status:    StatusPass,
+		Duration:  time.Since(now).String(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		c.result.Status = StatusFail
+		c.result.Error = err.Error()
+	}
+	c.expiry = now.Add(cache)
+	return c.result
+}
+
+func (c *cachedChecker) safeCheck(ctx context.Context) (err error) {
+	defer func() {
+		if recovered := exception.Recover(recover()); recovered != nil {
+			err = recovered
+		}
+	}()
+	return c.Check(ctx)
+}
@@ -0,0 +1,206 @@
+package http
+
+import (
+	"crypto/tls"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	AccessLogJson     = "json"
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
+// accessLogger writes a single event per request, in place of the request and
+// response events.
+type accessLogger struct {
+	format      string
+	excludes    []string
+	successRate float64
+	trusted     []netip.Prefix
+}
+
+func newAccessLogger(config *ServerConfig, trusted []netip.Prefix) *accessLogger {
+	if !config.AccessLog {
+		return nil
+	}
+	return &accessLogger{
+		format:      config.AccessLogFormat,
+		excludes:    config.AccessLogExcludes,
+		successRate: config.AccessLogSuccessRate,
+		trusted:     trusted,
+	}
+}
+
+// parseTrustedProxies parses ips and cidrs, logging and skipping invalid ones.
+func parseTrustedProxies(logger *zerolog.Logger, values []string) []netip.Prefix {
+	trusted := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if address, err := netip.ParseAddr(value); err == nil {
+			trusted = append(trusted, netip.PrefixFrom(address.Unmap(), address.Unmap().BitLen()))
+		} else if prefix, err := netip.ParsePrefix(value); err == nil {
+			trusted = append(trusted, prefix.Masked())
+		} else {
+			logger.Error().Err(err).Str("proxy", value).Msg("Ignored invalid trusted proxy")
+		}
+	}
+	return trusted
+}
+
+// excluded reports whether the path is excluded, an exclusion ending with "*"
+// matches by prefix.
+func (a *accessLogger) excluded(path string) bool {
+	for _, exclude := range a.excludes {
+		if prefix, isPrefix := strings.CutSuffix(exclude, "*"); isPrefix && strings.HasPrefix(path, prefix) {
+			return true
+		} else if path == exclude {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled drops a share of the successful responses.
+func (a *accessLogger) sampled(status int) bool {
+	if status < 200 || status > 299 || a.successRate >= 1 {
+		return true
+	}
+	return rand.Float64() < a.successRate
+}
+
+type accessEntry struct {
+	request       *http.Request
+	route         string
+	status        int
+	requestBytes  int64
+	responseBytes int
+	start         time.Time
+	duration      time.Duration
+}
+
+func (a *accessLogger) write(logger *zerolog.Logger, entry accessEntry) {
+	request := entry.request
+	if a.excluded(request.URL.Path) || !a.sampled(entry.status) {
+		return
+	}
+	clientIP := ClientIP(request, a.trusted)
+	switch a.format {
+	case AccessLogCommon, AccessLogCombined:
+		line := strings.Builder{}
+		line.WriteString(orDash(clientIP))
+		line.WriteString(" - - [")
+		line.WriteString(entry.start.Format("02/Jan/2006:15:04:05 -0700"))
+		line.WriteString(`] "`)
+		line.WriteString(request.Method + " " + request.URL.RequestURI() + " " + request.Proto)
+		line.WriteString(`" `)
+		line.WriteString(strconv.Itoa(entry.status))
+		line.WriteString(" ")
+		if entry.responseBytes > 0 {
+			line.WriteString(strconv.Itoa(entry.responseBytes))
+		} else {
+			line.WriteString("-")
+		}
+		if a.format == AccessLogCombined {
+			line.WriteString(` "` + escapeQuoted(orDash(request.Referer())) + `"`)
+			line.WriteString(` "` + escapeQuoted(orDash(request.UserAgent())) + `"`)
+		}
+		logger.Info().Msg(line.String())
+	default:
+		event := logger.Info().
+			Str("method", request.Method).
+			Stringer("url", request.URL).
+			Str("route", entry.route).
+			Str("protocol", request.Proto).
+			Str("remote_ip", clientIP).
+			Str("user_agent", request.UserAgent()).
+			Str("referer", request.Referer()).
+			Int64("request_bytes", entry.requestBytes).
+			Int("status", entry.status).
+			Int("bytes", entry.responseBytes).
+			Dur("duration", entry.duration)
+		if request.TLS != nil {
+			event = event.Str("tls_version", tls.VersionName(request.TLS.Version))
+		}
+		event.Msg("Access")
+	}
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+var quotedReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+func escapeQuoted(value string) string {
+	return quotedReplacer.Replace(value)
+}
+
+// ClientIP returns the ip of the client. The forwarding headers are only
+// trusted when the request comes from a trusted proxy, in which case the
+// X-Forwarded-For chain is walked from the right, skipping trusted proxies.
+func ClientIP(request *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(remote, trusted) {
+		return host
+	}
+	forwarded := request.Header.Values("X-Forwarded-For")
+	for index := len(forwarded) - 1; index >= 0; index-- {
+		parts := strings.Split(forwarded[index], ",")
+		for part := len(parts) - 1; part >= 0; part-- {
+			address, err := netip.ParseAddr(strings.TrimSpace(parts[part]))
+			if err != nil {
+				return host
+			}
+			if !isTrusted(address, trusted) {
+				return address.String()
+			}
+		}
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(request.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.String()
+	}
+	return host
+}
+
+func isTrusted(address netip.Addr, trusted []netip.Prefix) bool {
+	address = address.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// countingReader counts the bytes of the request body read by the handler.
+type countingReader struct {
+	io.ReadCloser
+	count atomic.Int64
+}
+
+func (r *countingReader) Read(buffer []byte) (int, error) {
+	read, err := r.ReadCloser.Read(buffer)
+	r.count.Add(int64(read))
+	return read, err
+}
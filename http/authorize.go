@@ -0,0 +1,216 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/rs/zerolog"
+)
+
+// Policy decides whether a principal may access a route. Its string is shown
+// in the route dump of the server, to audit the routes at startup.
+type Policy interface {
+	// Allow is never called with a nil principal, anonymous requests are
+	// answered with 401 Unauthorized before.
+	Allow(principal *Principal) bool
+	String() string
+}
+
+//region policies
+
+type policyFunc struct {
+	name  string
+	allow func(principal *Principal) bool
+}
+
+func (p policyFunc) Allow(principal *Principal) bool {
+	return p.allow(principal)
+}
+
+func (p policyFunc) String() string {
+	return p.name
+}
+
+// NewPolicy creates a policy from a function, the name is used in the route
+// dump.
+func NewPolicy(name string, allow func(principal *Principal) bool) Policy {
+	return policyFunc{name: name, allow: allow}
+}
+
+// Authenticated allows any principal.
+func Authenticated() Policy {
+	return NewPolicy("authenticated", func(*Principal) bool {
+		return true
+	})
+}
+
+// Scopes allows the principals having all the scopes.
+func Scopes(scopes ...string) Policy {
+	return NewPolicy("scopes("+strings.Join(scopes, ",")+")", func(principal *Principal) bool {
+		for _, scope := range scopes {
+			if !slices.Contains(principal.Scopes, scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Roles allows the principals having any of the roles.
+func Roles(roles ...string) Policy {
+	return RoleHierarchy(nil).Roles(roles...)
+}
+
+// AllOf allows the principals allowed by all the policies.
+func AllOf(policies ...Policy) Policy {
+	return NewPolicy("all("+joinPolicies(policies)+")", func(principal *Principal) bool {
+		for _, policy := range policies {
+			if !policy.Allow(principal) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyOf allows the principals allowed by any of the policies.
+func AnyOf(policies ...Policy) Policy {
+	return NewPolicy("any("+joinPolicies(policies)+")", func(principal *Principal) bool {
+		for _, policy := range policies {
+			if policy.Allow(principal) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func joinPolicies(policies []Policy) string {
+	names := make([]string, len(policies))
+	for index, policy := range policies {
+		names[index] = policy.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// RoleHierarchy maps a role to the roles it implies, such as "admin" implying
+// "editor" which implies "viewer".
+type RoleHierarchy map[string][]string
+
+// Expand returns the roles and all the roles they imply.
+func (h RoleHierarchy) Expand(roles []string) []string {
+	expanded := append([]string{}, roles...)
+	for index := 0; index < len(expanded); index++ {
+		for _, implied := range h[expanded[index]] {
+			if !slices.Contains(expanded, implied) {
+				expanded = append(expanded, implied)
+			}
+		}
+	}
+	return expanded
+}
+
+// Roles allows the principals having any of the roles, directly or through the
+// hierarchy.
+func (h RoleHierarchy) Roles(roles ...string) Policy {
+	return NewPolicy("roles("+strings.Join(roles, ",")+")", func(principal *Principal) bool {
+		for _, role := range h.Expand(principal.Roles) {
+			if slices.Contains(roles, role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (h RoleHierarchy) RequireRoles(roles ...string) Middleware {
+	return Authorize(h.Roles(roles...))
+}
+
+//endregion policies
+
+//region Authorize
+
+// Authorize creates a middleware allowing the principals allowed by all the
+// policies. Anonymous requests are answered with 401 Unauthorized, and the
+// principals not allowed with 403 Forbidden.
+func Authorize(policies ...Policy) Middleware {
+	if len(policies) == 0 {
+		panic("BUG: policies must not be empty")
+	}
+	policy := policies[0]
+	if len(policies) > 1 {
+		policy = AllOf(policies...)
+	}
+	middleware := func(next http.Handler) http.Handler {
+		return &authorizeHandler{policy: policy, next: next}
+	}
+	authorizePolicies.Store(middlewareKey(middleware), policy)
+	return middleware
+}
+
+func RequireAuthenticated() Middleware {
+	return Authorize(Authenticated())
+}
+
+func RequireScopes(scopes ...string) Middleware {
+	return Authorize(Scopes(scopes...))
+}
+
+func RequireRoles(roles ...string) Middleware {
+	return Authorize(Roles(roles...))
+}
+
+type authorizeHandler struct {
+	policy Policy
+	next   http.Handler
+}
+
+func (h *authorizeHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	var response *ServerErrorResponse
+	if principal := PrincipalFromContext(request.Context()); principal == nil {
+		response = Unauthorized(request, ErrUnauthenticated)
+	} else if !h.policy.Allow(principal) {
+		response = Forbidden(request, ErrPermissionDenied)
+	} else {
+		h.next.ServeHTTP(writer, request)
+		return
+	}
+	logger := zerolog.Ctx(request.Context())
+	logger.Info().Int("status", response.Status).Stringer("policy", h.policy).Msg("Access denied")
+	if err := response.Render(writer); err != nil {
+		logger.Error().Err(err).Msg("Failed to render error")
+	}
+}
+
+// authorizePolicies maps the middlewares created by Authorize to their policy,
+// so that the route dump finds them without calling any middleware.
+var authorizePolicies sync.Map
+
+// middlewareKey identifies a middleware by its closure, which is allocated by
+// every Authorize call since it captures the policy. The code pointer given by
+// reflect is shared by all the closures of a function literal.
+func middlewareKey(middleware Middleware) unsafe.Pointer {
+	// a func value is a pointer to its closure
+	return *(*unsafe.Pointer)(unsafe.Pointer(&middleware))
+}
+
+// routePolicies returns the policies among the middlewares of a route.
+func routePolicies(handler http.Handler, middlewares []Middleware) []string {
+	var policies []string
+	for _, middleware := range middlewares {
+		if policy, exists := authorizePolicies.Load(middlewareKey(middleware)); exists {
+			policies = append(policies, policy.(Policy).String())
+		}
+	}
+	// the endpoint itself may be wrapped, as in Authorize(policy)(handler)
+	for wrapped, ok := handler.(*authorizeHandler); ok; wrapped, ok = wrapped.next.(*authorizeHandler) {
+		policies = append(policies, wrapped.policy.String())
+	}
+	return policies
+}
+
+//endregion Authorize
@@ -0,0 +1,293 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// Codec encodes and decodes the bodies of some media types. The codecs are
+// registered with RegisterCodec, JSON and XML are registered by default, the
+// others by importing their package under codec, such as codec/cbor.
+type Codec interface {
+	// MediaTypes returns the media types of the codec, the first one is
+	// preferred in responses.
+	MediaTypes() []string
+	// Suffix returns the structured syntax suffix of the codec, such as "json"
+	// for "application/vnd.api+json", or empty if none.
+	Suffix() string
+	Decode(reader io.Reader, value any) error
+	Encode(writer io.Writer, value any) error
+}
+
+//region registry
+
+type codecRegistry struct {
+	mutex    sync.RWMutex
+	types    []string
+	codecs   map[string]Codec
+	suffixes map[string]Codec
+}
+
+var codecs = &codecRegistry{
+	codecs:   map[string]Codec{},
+	suffixes: map[string]Codec{},
+}
+
+func init() {
+	RegisterCodec(JsonCodec{})
+	RegisterCodec(XmlCodec{})
+}
+
+// RegisterCodec registers a codec for its media types and suffix, replacing
+// the codec previously registered for them.
+func RegisterCodec(codec Codec) {
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	for _, mediaType := range codec.MediaTypes() {
+		if _, exists := codecs.codecs[mediaType]; !exists {
+			codecs.types = append(codecs.types, mediaType)
+		}
+		codecs.codecs[mediaType] = codec
+	}
+	if suffix := codec.Suffix(); suffix != "" {
+		codecs.suffixes[suffix] = codec
+	}
+}
+
+// LookupCodec returns the codec of a media type, matched exactly or by its
+// structured syntax suffix, or nil if none.
+func LookupCodec(mediaType string) Codec {
+	codecs.mutex.RLock()
+	defer codecs.mutex.RUnlock()
+	if codec, exists := codecs.codecs[mediaType]; exists {
+		return codec
+	}
+	if index := strings.LastIndexByte(mediaType, '+'); index >= 0 {
+		return codecs.suffixes[mediaType[index+1:]]
+	}
+	return nil
+}
+
+// codecTypes returns the registered media types, in registration order.
+func codecTypes() []string {
+	codecs.mutex.RLock()
+	defer codecs.mutex.RUnlock()
+	return slices.Clone(codecs.types)
+}
+
+//endregion registry
+
+//region codecs
+
+type JsonCodec struct{}
+
+func (JsonCodec) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (JsonCodec) Suffix() string {
+	return "json"
+}
+
+func (JsonCodec) Decode(reader io.Reader, value any) error {
+	return json.NewDecoder(reader).Decode(value)
+}
+
+func (JsonCodec) Encode(writer io.Writer, value any) error {
+	return json.NewEncoder(writer).Encode(value)
+}
+
+type XmlCodec struct{}
+
+func (XmlCodec) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (XmlCodec) Suffix() string {
+	return "xml"
+}
+
+func (XmlCodec) Decode(reader io.Reader, value any) error {
+	return xml.NewDecoder(reader).Decode(value)
+}
+
+func (XmlCodec) Encode(writer io.Writer, value any) error {
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(writer).Encode(value)
+}
+
+//endregion codecs
+
+//region negotiation
+
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, parameters, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if value, exists := parameters["q"]; exists {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// specificity returns how specific the range matches the media type, or zero
+// if it does not match.
+func (a acceptRange) specificity(mediaType string) int {
+	switch {
+	case a.mediaType == mediaType:
+		return 3
+	case strings.HasSuffix(a.mediaType, "/*") && strings.HasPrefix(mediaType, a.mediaType[:len(a.mediaType)-1]):
+		return 2
+	case a.mediaType == "*/*":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// acceptQuality returns the quality of the most specific range matching the
+// media type, or -1 if none matches.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	quality, specificity := -1.0, 0
+	for _, accepted := range ranges {
+		if current := accepted.specificity(mediaType); current > specificity {
+			quality, specificity = accepted.quality, current
+		}
+	}
+	return quality
+}
+
+// negotiateCodec returns the media type and the codec of a response, among
+// the offered media types by preference, or all the registered ones when none
+// is offered. A concrete media type of Accept matching the offers, such as
+// "application/vnd.api+json", is also offered if a codec resolves it.
+func negotiateCodec(accept string, offers []string) (string, Codec) {
+	restricted := len(offers) > 0
+	if !restricted {
+		offers = codecTypes()
+	}
+	if strings.TrimSpace(accept) == "" {
+		for _, offer := range offers {
+			if codec := LookupCodec(offer); codec != nil && !strings.Contains(offer, "*") {
+				return offer, codec
+			}
+		}
+		return "", nil
+	}
+	ranges := parseAccept(accept)
+	candidates := slices.Clone(offers)
+	for _, accepted := range ranges {
+		if !strings.Contains(accepted.mediaType, "*") && !slices.Contains(candidates, accepted.mediaType) &&
+			(!restricted || matchMediaType(accepted.mediaType, offers)) {
+			candidates = append(candidates, accepted.mediaType)
+		}
+	}
+	best, bestQuality := "", 0.0
+	for _, candidate := range candidates {
+		if strings.Contains(candidate, "*") || LookupCodec(candidate) == nil {
+			continue
+		}
+		if quality := acceptQuality(ranges, candidate); quality > bestQuality {
+			best, bestQuality = candidate, quality
+		}
+	}
+	if best == "" {
+		return "", nil
+	}
+	return best, LookupCodec(best)
+}
+
+//endregion negotiation
+
+//region bindCodec
+
+func bindCodec(request *http.Request, parsed any, fieldIndex int, codec Codec) *ServerErrorResponse {
+	// decode the whole body to the codec field, a pointer field is allocated
+	// and given as is, such as the protobuf messages
+	field := reflect.ValueOf(parsed).Elem().Field(fieldIndex)
+	target := field.Addr()
+	if field.Kind() == reflect.Pointer {
+		target = reflect.New(field.Type().Elem())
+	}
+	if err := codec.Decode(request.Body, target.Interface()); err != nil {
+		return &ServerErrorResponse{
+			Cause:  exception.String("Decode body failed").AddCause(err),
+			Status: http.StatusBadRequest,
+		}
+	}
+	if field.Kind() == reflect.Pointer {
+		field.Set(target)
+	}
+	return nil
+}
+
+//endregion bindCodec
+
+//region ServerCodecResponse
+
+// ServerCodecResponse encodes the response with the codec negotiated from the
+// Accept header of the request, answering 406 Not Acceptable if none is
+// acceptable. Render encodes it with the preferred codec.
+type ServerCodecResponse struct {
+	Status   int
+	Response any
+	// MediaTypes are the offered media types by preference, with an optional
+	// "*" wildcard such as "application/*+json", defaulting to all the
+	// registered codecs.
+	MediaTypes []string
+}
+
+func (r ServerCodecResponse) Render(writer http.ResponseWriter) error {
+	return r.RenderRequest(writer, &http.Request{Header: http.Header{}})
+}
+
+func (r ServerCodecResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	mediaType, codec := negotiateCodec(request.Header.Get("Accept"), r.MediaTypes)
+	addVary(writer.Header(), "Accept")
+	if codec == nil {
+		return ServerErrorResponse{
+			Status:    http.StatusNotAcceptable,
+			Cause:     exception.String("No acceptable media type"),
+			RequestID: RequestID(request.Context()),
+		}.Render(writer)
+	}
+	writer.Header().Set("Content-Type", mime.FormatMediaType(mediaType, textCharset(mediaType)))
+	writer.WriteHeader(r.Status)
+	return codec.Encode(writer, r.Response)
+}
+
+// textCharset returns the charset parameter of the textual media types.
+func textCharset(mediaType string) map[string]string {
+	if strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "xml") {
+		return map[string]string{"charset": "utf-8"}
+	}
+	return nil
+}
+
+//endregion ServerCodecResponse
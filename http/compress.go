@@ -0,0 +1,402 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// CompressionConfig configures the compression of responses, negotiated from
+// Accept-Encoding, and the decompression of requests, selected by
+// Content-Encoding. The encodings are listed by server preference, and the
+// types are media types with an optional "*" wildcard, such as "text/*" or
+// "application/*+json".
+type CompressionConfig struct {
+	Compression                 bool     `env:"HTTP_SERVER_COMPRESSION"`
+	CompressionEncodings        []string `env:"HTTP_SERVER_COMPRESSION_ENCODINGS" validate:"dive,oneof=zstd br gzip deflate"`
+	CompressionMinSize          uint32   `env:"HTTP_SERVER_COMPRESSION_MIN_SIZE"`
+	CompressionTypes            []string `env:"HTTP_SERVER_COMPRESSION_TYPES"`
+	CompressionExcludedTypes    []string `env:"HTTP_SERVER_COMPRESSION_EXCLUDED_TYPES"`
+	RequestDecompression        bool     `env:"HTTP_SERVER_REQUEST_DECOMPRESSION"`
+	RequestDecompressionMaxSize uint32   `env:"HTTP_SERVER_REQUEST_DECOMPRESSION_MAX_SIZE" validate:"min=1"`
+}
+
+func init() {
+	configuration.SetDefault("HTTP_SERVER_COMPRESSION", "false")
+	configuration.SetDefault("HTTP_SERVER_COMPRESSION_ENCODINGS", "zstd;br;gzip;deflate")
+	configuration.SetDefault("HTTP_SERVER_COMPRESSION_MIN_SIZE", "1024")
+	configuration.SetDefault("HTTP_SERVER_COMPRESSION_TYPES", "text/*;application/json;application/*+json;"+
+		"application/x-ndjson;application/javascript;application/xml;application/*+xml;image/svg+xml")
+	configuration.SetDefault("HTTP_SERVER_REQUEST_DECOMPRESSION", "false")
+	configuration.SetDefault("HTTP_SERVER_REQUEST_DECOMPRESSION_MAX_SIZE", "10485760")
+}
+
+//region encoders
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(writer io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() any {
+		return zlib.NewWriter(nil)
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"zstd": {New: func() any {
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic("BUG: zstd options are invalid: " + err.Error())
+		}
+		return encoder
+	}},
+}
+
+// negotiateEncoding returns the preferred encoding accepted by the client, or
+// an empty string for no compression.
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	accepted := map[string]bool{}
+	wildcard := false
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(parameters), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = quality > 0
+		} else {
+			accepted[name] = quality > 0
+		}
+	}
+	for _, encoding := range encodings {
+		if allowed, listed := accepted[encoding]; allowed || !listed && wildcard {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// matchMediaType matches a media type against patterns such as "text/*" or
+// "application/*+json".
+func matchMediaType(mediaType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard && mediaType == pattern ||
+			wildcard && len(mediaType) >= len(prefix)+len(suffix) &&
+				strings.HasPrefix(mediaType, prefix) && strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+//endregion encoders
+
+//region Compression
+
+type compression struct {
+	config        *CompressionConfig
+	encodings     []string
+	types         []string
+	excludedTypes []string
+}
+
+// Compression creates the middleware compressing the responses and, if
+// enabled, decompressing the requests.
+func Compression(config *CompressionConfig) Middleware {
+	c := &compression{config: config}
+	for _, encoding := range config.CompressionEncodings {
+		if encoding = strings.ToLower(strings.TrimSpace(encoding)); encoderPools[encoding] != nil {
+			c.encodings = append(c.encodings, encoding)
+		}
+	}
+	for _, mediaType := range config.CompressionTypes {
+		c.types = append(c.types, strings.ToLower(strings.TrimSpace(mediaType)))
+	}
+	for _, mediaType := range config.CompressionExcludedTypes {
+		c.excludedTypes = append(c.excludedTypes, strings.ToLower(strings.TrimSpace(mediaType)))
+	}
+	return c.handler
+}
+
+func (c *compression) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if c.config.RequestDecompression {
+			if errorResponse := c.decompress(writer, request); errorResponse != nil {
+				if err := errorResponse.Render(writer); err != nil {
+					zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render error")
+				}
+				return
+			}
+		}
+		if !c.config.Compression || request.Method == http.MethodHead || isUpgrade(request) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		compressWriter := &compressWriter{
+			ResponseWriter: writer,
+			compression:    c,
+			encoding:       negotiateEncoding(request.Header.Get("Accept-Encoding"), c.encodings),
+		}
+		// the encoder goes back to the pool even on a panic, but the response
+		// is only finished on return, a panic must leave the response
+		// unstarted for the recovery to render the error
+		defer compressWriter.release()
+		next.ServeHTTP(compressWriter, request)
+		if err := compressWriter.Close(); err != nil {
+			zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to finish compressed response")
+		}
+	})
+}
+
+// eligible reports whether a response of this type may be compressed.
+func (c *compression) eligible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return matchMediaType(mediaType, c.types) && !matchMediaType(mediaType, c.excludedTypes)
+}
+
+// compressWriter buffers the beginning of the response, until it knows whether
+// the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *compression
+	encoding    string
+	status      int
+	buffer      []byte
+	decided     bool
+	hijacked    bool
+	encoder     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	// informational responses are sent as is, the final one is held until the
+	// decision is made
+	if w.decided || status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+	} else if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < int(w.compression.config.CompressionMinSize) {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide chooses whether to compress and writes the header and the buffer.
+// A response that is not complete yet is compressed whatever its size.
+func (w *compressWriter) decide(incomplete bool) error {
+	w.decided = true
+	header := w.Header()
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if header.Get("Content-Type") == "" && len(w.buffer) > 0 && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+	compress := false
+	if w.compression.eligible(header.Get("Content-Type")) &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified &&
+		w.status != http.StatusPartialContent && header.Get("Content-Encoding") == "" {
+		addVary(header, "Accept-Encoding")
+		compress = w.encoding != "" && (incomplete || len(w.buffer) >= int(w.compression.config.CompressionMinSize))
+	}
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		// the representation changed, a strong validator must not match it
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.encoder = encoderPools[w.encoding].Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buffer)
+	} else {
+		_, err = w.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+func (w *compressWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return
+		}
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the response, the writer must not be used afterward.
+func (w *compressWriter) Close() error {
+	if w.hijacked {
+		return nil
+	}
+	if !w.decided {
+		// nothing written at all, keep the implicit status of net/http
+		if w.status == 0 && len(w.buffer) == 0 {
+			w.decided = true
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	return w.release()
+}
+
+// release closes the encoder, if any, and returns it to its pool.
+func (w *compressWriter) release() error {
+	if w.encoder == nil {
+		return nil
+	}
+	var err error
+	if !w.hijacked {
+		err = w.encoder.Close()
+	}
+	w.encoder.Reset(nil)
+	encoderPools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	connection, readWriter, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return connection, readWriter, err
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//endregion Compression
+
+//region decompression
+
+// decompress replaces the body of a compressed request with its decompressed
+// content, bounded by the maximum size.
+func (c *compression) decompress(writer http.ResponseWriter, request *http.Request) *ServerErrorResponse {
+	encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(request.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(request.Body)
+	case "br":
+		reader = io.NopCloser(brotli.NewReader(request.Body))
+	case "zstd":
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(request.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(c.config.RequestDecompressionMaxSize)))
+		if err == nil {
+			reader = decoder.IOReadCloser()
+		}
+	default:
+		return &ServerErrorResponse{
+			Status:    http.StatusUnsupportedMediaType,
+			Cause:     exception.String("Content-Encoding is unsupported"),
+			RequestID: RequestID(request.Context()),
+			Header:    http.Header{"Accept-Encoding": {strings.Join(c.encodings, ", ")}},
+		}
+	}
+	if err != nil {
+		return &ServerErrorResponse{
+			Status:    http.StatusBadRequest,
+			Cause:     exception.String("Request body is not valid " + encoding).AddCause(err),
+			RequestID: RequestID(request.Context()),
+		}
+	}
+	request.Body = &decompressedBody{
+		Reader:     http.MaxBytesReader(writer, reader, int64(c.config.RequestDecompressionMaxSize)),
+		decoder:    reader,
+		compressed: request.Body,
+	}
+	request.Header.Del("Content-Encoding")
+	request.Header.Del("Content-Length")
+	request.ContentLength = -1
+	return nil
+}
+
+type decompressedBody struct {
+	io.Reader
+	decoder    io.Closer
+	compressed io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	err := b.decoder.Close()
+	if closeErr := b.compressed.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//endregion decompression
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CorsConfig configures the CORS middleware. An allowed origin is either "*",
+// an exact origin such as "https://example.com", a wildcard subdomain such as
+// "https://*.example.com", or a regular expression prefixed by "~".
+type CorsConfig struct {
+	Enabled             bool     `env:"HTTP_SERVER_CORS_ENABLED"`
+	AllowedOrigins      []string `env:"HTTP_SERVER_CORS_ALLOWED_ORIGINS"`
+	AllowedMethods      []string `env:"HTTP_SERVER_CORS_ALLOWED_METHODS"`
+	AllowedHeaders      []string `env:"HTTP_SERVER_CORS_ALLOWED_HEADERS"`
+	ExposedHeaders      []string `env:"HTTP_SERVER_CORS_EXPOSED_HEADERS"`
+	AllowCredentials    bool     `env:"HTTP_SERVER_CORS_ALLOW_CREDENTIALS"`
+	AllowPrivateNetwork bool     `env:"HTTP_SERVER_CORS_ALLOW_PRIVATE_NETWORK"`
+	MaxAge              uint32   `env:"HTTP_SERVER_CORS_MAX_AGE" validate:"min=0,max=86400"`
+}
+
+func init() {
+	configuration.SetDefault("HTTP_SERVER_CORS_ENABLED", "false")
+	configuration.SetDefault("HTTP_SERVER_CORS_ALLOWED_METHODS", "GET;HEAD;POST;PUT;PATCH;DELETE")
+	configuration.SetDefault("HTTP_SERVER_CORS_ALLOWED_HEADERS", "Accept;Accept-Language;Authorization;Content-Type;X-Request-ID")
+	configuration.SetDefault("HTTP_SERVER_CORS_EXPOSED_HEADERS", "X-Request-ID")
+	configuration.SetDefault("HTTP_SERVER_CORS_MAX_AGE", "600")
+}
+
+type corsOrigin struct {
+	exact  string
+	prefix string
+	suffix string
+	regex  *regexp.Regexp
+}
+
+func (o corsOrigin) matches(origin string) bool {
+	switch {
+	case o.regex != nil:
+		return o.regex.MatchString(origin)
+	case o.exact != "":
+		return strings.EqualFold(o.exact, origin)
+	default:
+		// the wildcard must match at least one character, and no scheme or port
+		origin = strings.ToLower(origin)
+		if len(origin) <= len(o.prefix)+len(o.suffix) ||
+			!strings.HasPrefix(origin, o.prefix) || !strings.HasSuffix(origin, o.suffix) {
+			return false
+		}
+		return !strings.ContainsAny(origin[len(o.prefix):len(origin)-len(o.suffix)], "/:")
+	}
+}
+
+type cors struct {
+	allowAll         bool
+	origins          []corsOrigin
+	methods          []string
+	headers          []string
+	allowAllHeaders  bool
+	exposed          string
+	credentials      bool
+	privateNetwork   bool
+	maxAge           string
+	allowedMethodsCS string
+}
+
+// Cors creates the CORS middleware, which answers the preflight requests of
+// the existing routes by itself, whether or not a route is registered for the
+// OPTIONS method. It panics if a regular expression is invalid, the regular
+// expressions must match the whole origin.
+func Cors(config *CorsConfig) Middleware {
+	c := &cors{
+		credentials:    config.AllowCredentials,
+		privateNetwork: config.AllowPrivateNetwork,
+		exposed:        strings.Join(config.ExposedHeaders, ", "),
+		maxAge:         strconv.FormatUint(uint64(config.MaxAge), 10),
+	}
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.HasPrefix(origin, "~"):
+			// anchored, so that the pattern cannot match a part of the origin
+			c.origins = append(c.origins, corsOrigin{regex: regexp.MustCompile(`^(?:` + origin[1:] + `)$`)})
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			c.origins = append(c.origins, corsOrigin{prefix: prefix, suffix: suffix})
+		case origin != "":
+			c.origins = append(c.origins, corsOrigin{exact: origin})
+		}
+	}
+	for _, method := range config.AllowedMethods {
+		c.methods = append(c.methods, strings.ToUpper(strings.TrimSpace(method)))
+	}
+	c.allowedMethodsCS = strings.Join(c.methods, ", ")
+	for _, header := range config.AllowedHeaders {
+		if header = strings.TrimSpace(header); header == "*" {
+			c.allowAllHeaders = true
+		} else if header != "" {
+			c.headers = append(c.headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return c.handler
+}
+
+func (c *cors) allowedOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	for _, allowed := range c.origins {
+		if allowed.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) allowedHeaders(requested string) bool {
+	if c.allowAllHeaders {
+		return true
+	}
+	for header := range strings.SplitSeq(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !slices.Contains(c.headers, http.CanonicalHeaderKey(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cors) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		header := writer.Header()
+		// preflight request
+		if request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != "" {
+			// the unknown routes are answered by the router
+			if !routeExists(request, request.Header.Get("Access-Control-Request-Method")) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			header.Add("Vary", "Origin")
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			if c.privateNetwork {
+				header.Add("Vary", "Access-Control-Request-Private-Network")
+			}
+			method := strings.ToUpper(request.Header.Get("Access-Control-Request-Method"))
+			requestedHeaders := request.Header.Get("Access-Control-Request-Headers")
+			if origin != "" && c.allowedOrigin(origin) && slices.Contains(c.methods, method) && c.allowedHeaders(requestedHeaders) {
+				c.allowOrigin(header, origin)
+				header.Set("Access-Control-Allow-Methods", c.allowedMethodsCS)
+				if requestedHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", requestedHeaders)
+				}
+				if c.maxAge != "0" {
+					header.Set("Access-Control-Max-Age", c.maxAge)
+				}
+				if c.privateNetwork && request.Header.Get("Access-Control-Request-Private-Network") == "true" {
+					header.Set("Access-Control-Allow-Private-Network", "true")
+				}
+			}
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// actual request
+		header.Add("Vary", "Origin")
+		if origin != "" && c.allowedOrigin(origin) {
+			c.allowOrigin(header, origin)
+			if c.exposed != "" {
+				header.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// routeExists reports whether the router of the request has a route for the
+// method and the path, or true outside a chi router.
+func routeExists(request *http.Request, method string) bool {
+	routeContext := chi.RouteContext(request.Context())
+	if routeContext == nil || routeContext.Routes == nil {
+		return true
+	}
+	path := request.URL.Path
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return routeContext.Routes.Match(chi.NewRouteContext(), strings.ToUpper(method), path)
+}
+
+func (c *cors) allowOrigin(header http.Header, origin string) {
+	// the wildcard cannot be used with credentials
+	if c.allowAll && !c.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// decoratedResponse decorates the writer of a response, keeping it dependent on
+// the request if it is. A nil response has no content.
+type decoratedResponse struct {
+	response ServerResponse
+	decorate func(writer http.ResponseWriter) http.ResponseWriter
+}
+
+func (r decoratedResponse) Render(writer http.ResponseWriter) error {
+	writer = r.decorate(writer)
+	if r.response == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return r.response.Render(writer)
+}
+
+func (r decoratedResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	writer = r.decorate(writer)
+	if r.response == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return renderResponse(writer, request, r.response)
+}
+
+// WithHeader adds a header to the response, such as Cache-Control or Link. The
+// headers set by the response itself, such as Content-Type, take precedence.
+func WithHeader(response ServerResponse, key string, value string) ServerResponse {
+	return decoratedResponse{
+		response: response,
+		decorate: func(writer http.ResponseWriter) http.ResponseWriter {
+			writer.Header().Add(key, value)
+			return writer
+		},
+	}
+}
+
+// WithCookie sets a cookie with the response. Invalid cookies are dropped.
+func WithCookie(response ServerResponse, cookie *http.Cookie) ServerResponse {
+	return decoratedResponse{
+		response: response,
+		decorate: func(writer http.ResponseWriter) http.ResponseWriter {
+			http.SetCookie(writer, cookie)
+			return writer
+		},
+	}
+}
+
+// WithStatus replaces the successful status of the response, such as 202
+// Accepted. The error statuses of the response are kept.
+func WithStatus(response ServerResponse, status int) ServerResponse {
+	if status < 100 || status > 999 {
+		panic("BUG: invalid status " + strconv.Itoa(status))
+	}
+	return decoratedResponse{
+		response: response,
+		decorate: func(writer http.ResponseWriter) http.ResponseWriter {
+			return &statusWriter{ResponseWriter: writer, status: status}
+		},
+	}
+}
+
+// CreatedAt answers 201 Created with the Location of the created resource, and
+// the response as content if not nil.
+func CreatedAt(location string, response ServerResponse) ServerResponse {
+	return WithStatus(WithHeader(response, "Location", location), http.StatusCreated)
+}
+
+// Redirect redirects to the location, which may be relative to the request
+// path, with a 3xx status such as 303 See Other.
+func Redirect(status int, location string) ServerResponse {
+	if status < 300 || status > 399 {
+		panic("BUG: redirect status must be 3xx")
+	}
+	return redirectResponse{status: status, location: location}
+}
+
+type redirectResponse struct {
+	status   int
+	location string
+}
+
+func (r redirectResponse) Render(writer http.ResponseWriter) error {
+	writer.Header().Set("Location", r.location)
+	writer.WriteHeader(r.status)
+	return nil
+}
+
+func (r redirectResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	http.Redirect(writer, request, r.location, r.status)
+	return nil
+}
+
+// statusWriter replaces the first successful status written.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.written {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// informational responses are not final
+	if status >= http.StatusOK {
+		w.written = true
+		if status < http.StatusMultipleChoices {
+			status = w.status
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
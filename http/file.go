@@ -0,0 +1,295 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+//region ServerFileResponse
+
+// ServerFileResponse serves a file with the range and conditional requests,
+// either the Path of FS, the Path on disk when FS is nil, or the Content. The
+// ETag and the modification time of a Path are derived from its size and
+// modification time, unless set.
+type ServerFileResponse struct {
+	FS      fs.FS
+	Path    string
+	Content io.ReadSeeker
+	// Name is used to detect the content type of the Content, defaulting to the
+	// base name of the Path.
+	Name         string
+	ContentType  string
+	ModTime      time.Time
+	ETag         string
+	CacheControl string
+	// Disposition is the Content-Disposition, see AttachmentDisposition and
+	// InlineDisposition.
+	Disposition string
+	// Encoding is the Content-Encoding of a precompressed file.
+	Encoding string
+}
+
+func (r ServerFileResponse) Render(writer http.ResponseWriter) error {
+	return r.RenderRequest(writer, &http.Request{Method: http.MethodGet, Header: http.Header{}})
+}
+
+func (r ServerFileResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	content, name, modTime, etag, err := r.open()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		return ServerErrorResponse{
+			Status:    status,
+			Cause:     err,
+			RequestID: RequestID(request.Context()),
+		}.Render(writer)
+	}
+	if closer, ok := content.(io.Closer); ok && r.Content == nil {
+		defer func() { _ = closer.Close() }()
+	}
+	header := writer.Header()
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	if r.CacheControl != "" {
+		header.Set("Cache-Control", r.CacheControl)
+	}
+	if r.Disposition != "" {
+		header.Set("Content-Disposition", r.Disposition)
+	}
+	if r.Encoding != "" {
+		header.Set("Content-Encoding", r.Encoding)
+		addVary(header, "Accept-Encoding")
+	}
+	// ServeContent answers the ranges, the conditions and HEAD requests
+	http.ServeContent(writer, request, name, modTime, content)
+	return nil
+}
+
+// open returns the content to serve with its name, modification time and ETag.
+func (r ServerFileResponse) open() (io.ReadSeeker, string, time.Time, string, error) {
+	name := r.Name
+	if name == "" {
+		name = path.Base(r.Path)
+	}
+	if r.Content != nil {
+		return r.Content, name, r.ModTime, r.ETag, nil
+	}
+	var file fs.File
+	var err error
+	if r.FS != nil {
+		file, err = r.FS.Open(r.Path)
+	} else {
+		file, err = os.Open(r.Path)
+	}
+	if err != nil {
+		return nil, "", time.Time{}, "", exception.String("Open file failed").AddCause(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, "", time.Time{}, "", exception.String("Stat file failed").AddCause(err)
+	}
+	if info.IsDir() {
+		_ = file.Close()
+		return nil, "", time.Time{}, "", exception.String("File is a directory").AddCause(fs.ErrNotExist)
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		_ = file.Close()
+		return nil, "", time.Time{}, "", exception.String("File is not seekable")
+	}
+	modTime, etag := r.ModTime, r.ETag
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+	if etag == "" {
+		etag = fileETag(info, r.Encoding)
+	}
+	return content, name, modTime, etag, nil
+}
+
+// fileETag derives an ETag from the size and the modification time, like most
+// static file servers. The encoding tells the precompressed variants apart.
+func fileETag(info fs.FileInfo, encoding string) string {
+	if info.ModTime().IsZero() {
+		// such as embed.FS, the size alone is too weak
+		return ""
+	}
+	if encoding != "" {
+		return fmt.Sprintf(`"%x-%x-%s"`, info.ModTime().UnixNano(), info.Size(), encoding)
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// AttachmentDisposition returns a Content-Disposition asking the client to
+// download the file with the file name.
+func AttachmentDisposition(filename string) string {
+	return contentDisposition("attachment", filename)
+}
+
+// InlineDisposition returns a Content-Disposition asking the client to display
+// the file, and to use the file name when it is saved.
+func InlineDisposition(filename string) string {
+	return contentDisposition("inline", filename)
+}
+
+func contentDisposition(disposition string, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	// encodes the non-ascii names as in RFC 2231
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); formatted != "" {
+		return formatted
+	}
+	return disposition
+}
+
+//endregion ServerFileResponse
+
+//region MountStatic
+
+// StaticOptions configures a static site mounted by MountStatic.
+type StaticOptions struct {
+	// Index is the file served for a directory, defaulting to "index.html".
+	Index string
+	// Fallback is the file served for the unknown paths requested by a
+	// browser navigation, such as the "index.html" of a single-page
+	// application. Empty disables it.
+	Fallback string
+	// Precompressed serves the ".br" and ".gz" files next to the requested
+	// one, when the client accepts them.
+	Precompressed bool
+	// CacheControl is set on every file, such as "public, max-age=3600".
+	CacheControl string
+}
+
+// precompressedEncodings are the encodings of the precompressed files, by
+// server preference, with their file extensions.
+var precompressedEncodings = []string{"br", "gzip"}
+
+var precompressedExtensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// MountStatic serves the files of a directory of the router, such as an
+// embed.FS or os.DirFS, under the pattern.
+func MountStatic(router chi.Router, pattern string, files fs.FS, options *StaticOptions) {
+	if options == nil {
+		options = &StaticOptions{}
+	}
+	static := &staticSite{files: files, options: *options}
+	if static.options.Index == "" {
+		static.options.Index = "index.html"
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern != "" {
+		router.Get(pattern, static.ServeHTTP)
+		router.Head(pattern, static.ServeHTTP)
+	}
+	router.Get(pattern+"/*", static.ServeHTTP)
+	router.Head(pattern+"/*", static.ServeHTTP)
+}
+
+type staticSite struct {
+	files   fs.FS
+	options StaticOptions
+}
+
+func (s *staticSite) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	name := path.Clean("/" + chi.URLParam(request, "*"))[1:]
+	if name == "" {
+		name = "."
+	}
+	response, found := s.lookup(name)
+	if !found && s.options.Fallback != "" && acceptsHtml(request) {
+		response, found = s.lookup(s.options.Fallback)
+		// the fallback changes with the application, never cache it
+		response.CacheControl = "no-cache"
+	}
+	if !found {
+		response := ServerErrorResponse{
+			Status:    http.StatusNotFound,
+			Cause:     exception.String("File not found"),
+			RequestID: RequestID(request.Context()),
+		}
+		if err := response.Render(writer); err != nil {
+			zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render error")
+		}
+		return
+	}
+	if s.options.Precompressed && s.precompressed(request, &response) && response.Encoding == "" {
+		addVary(writer.Header(), "Accept-Encoding")
+	}
+	if err := response.RenderRequest(writer, request); err != nil {
+		zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render response")
+	}
+}
+
+// lookup returns the response of a file, or of the index of a directory.
+func (s *staticSite) lookup(name string) (ServerFileResponse, bool) {
+	info, err := fs.Stat(s.files, name)
+	if err != nil {
+		return ServerFileResponse{}, false
+	}
+	if info.IsDir() {
+		name = path.Join(name, s.options.Index)
+		if info, err = fs.Stat(s.files, name); err != nil || info.IsDir() {
+			return ServerFileResponse{}, false
+		}
+	}
+	return ServerFileResponse{FS: s.files, Path: name, CacheControl: s.options.CacheControl}, true
+}
+
+// precompressed switches the response to a precompressed variant of the file,
+// if any is accepted. It returns whether the file has any variant.
+func (s *staticSite) precompressed(request *http.Request, response *ServerFileResponse) bool {
+	encodings := make([]string, 0, len(precompressedEncodings))
+	for _, encoding := range precompressedEncodings {
+		if _, err := fs.Stat(s.files, response.Path+precompressedExtensions[encoding]); err == nil {
+			encodings = append(encodings, encoding)
+		}
+	}
+	if len(encodings) == 0 {
+		return false
+	}
+	if encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"), encodings); encoding != "" {
+		response.Name = path.Base(response.Path)
+		response.Path += precompressedExtensions[encoding]
+		response.Encoding = encoding
+	}
+	return true
+}
+
+func acceptsHtml(request *http.Request) bool {
+	for _, value := range request.Header.Values("Accept") {
+		if strings.Contains(value, "text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+//endregion MountStatic
@@ -0,0 +1,352 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// MultipartConfig configures the binding of multipart forms. The values and
+// the files share the memory budget, the files exceeding it are spilled to
+// disk until the handler returns. The whole body is limited to the max size,
+// and the file parts, bound or not, to the max files.
+type MultipartConfig struct {
+	MultipartMaxMemory   int64  `env:"HTTP_SERVER_MULTIPART_MAX_MEMORY" validate:"min=0"`
+	MultipartMaxFileSize int64  `env:"HTTP_SERVER_MULTIPART_MAX_FILE_SIZE" validate:"min=1"`
+	MultipartMaxFiles    int    `env:"HTTP_SERVER_MULTIPART_MAX_FILES" validate:"min=1"`
+	MultipartMaxSize     int64  `env:"HTTP_SERVER_MULTIPART_MAX_SIZE" validate:"min=1"`
+	MultipartTempDir     string `env:"HTTP_SERVER_MULTIPART_TEMP_DIR"`
+}
+
+func init() {
+	configuration.SetDefault("HTTP_SERVER_MULTIPART_MAX_MEMORY", "1048576")
+	configuration.SetDefault("HTTP_SERVER_MULTIPART_MAX_FILE_SIZE", "33554432")
+	configuration.SetDefault("HTTP_SERVER_MULTIPART_MAX_FILES", "16")
+	configuration.SetDefault("HTTP_SERVER_MULTIPART_MAX_SIZE", "67108864")
+}
+
+// defaultMultipartConfig is used outside a server created by NewServer.
+var defaultMultipartConfig = MultipartConfig{
+	MultipartMaxMemory:   1 << 20,
+	MultipartMaxFileSize: 32 << 20,
+	MultipartMaxFiles:    16,
+	MultipartMaxSize:     64 << 20,
+}
+
+//region MultipartFile
+
+// MultipartFile is a file of a multipart form, bound to a *MultipartFile or a
+// []*MultipartFile field tagged with the form name, such as:
+//
+//	Avatar *MultipartFile `multipart:"avatar" maxSize:"1048576" accept:"image/png;image/jpeg"`
+//
+// The optional maxSize replaces HTTP_SERVER_MULTIPART_MAX_FILE_SIZE, and the
+// optional accept lists the allowed media types, matched against the sniffed
+// ContentType with an optional "*" wildcard.
+type MultipartFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	// ContentType is sniffed from the content, the client one is in Header.
+	ContentType string
+	Size        int64
+	content     []byte
+	path        string
+}
+
+// Open opens the content of the file, held in memory or spilled to disk.
+func (f *MultipartFile) Open() (multipart.File, error) {
+	if f.path == "" {
+		return nopCloserFile{Reader: bytes.NewReader(f.content)}, nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, exception.String("Open spilled file failed").AddCause(err)
+	}
+	return file, nil
+}
+
+type nopCloserFile struct {
+	*bytes.Reader
+}
+
+func (nopCloserFile) Close() error {
+	return nil
+}
+
+type multipartFileField struct {
+	index   int
+	name    string
+	slice   bool
+	maxSize int64
+	accept  []string
+}
+
+// checkMultipartFileField returns the file field of a multipart-tagged field,
+// or nil for a value field.
+func checkMultipartFileField(field reflect.StructField, index int, name string) *multipartFileField {
+	file := &multipartFileField{index: index, name: name}
+	switch field.Type {
+	case reflect.TypeFor[*MultipartFile]():
+	case reflect.TypeFor[[]*MultipartFile]():
+		file.slice = true
+	default:
+		if _, exists := field.Tag.Lookup("maxSize"); exists {
+			panic("BUG: maxSize tag is only allowed on a multipart file field")
+		}
+		if _, exists := field.Tag.Lookup("accept"); exists {
+			panic("BUG: accept tag is only allowed on a multipart file field")
+		}
+		return nil
+	}
+	if value, exists := field.Tag.Lookup("maxSize"); exists {
+		maxSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxSize <= 0 {
+			panic("BUG: maxSize tag value must be a positive integer")
+		}
+		file.maxSize = maxSize
+	}
+	if value, exists := field.Tag.Lookup("accept"); exists {
+		file.accept = strings.Split(value, ";")
+	}
+	return file
+}
+
+//endregion MultipartFile
+
+//region bindMultipartForm
+
+func multipartConfig(request *http.Request) *MultipartConfig {
+	if server := serverFromContext(request.Context()); server != nil && server.multipart != nil {
+		return server.multipart
+	}
+	return &defaultMultipartConfig
+}
+
+func bindMultipartForm(
+	request *http.Request,
+	parsed any,
+	files map[string]*multipartFileField,
+	parameters map[string]string,
+) (errorResponse *ServerErrorResponse) {
+	boundary, ok := parameters["boundary"]
+	if !ok {
+		return &ServerErrorResponse{
+			Cause:  exception.String("Boundary is missing in Content-Type of a multipart/form-data"),
+			Status: http.StatusBadRequest,
+		}
+	}
+	config := multipartConfig(request)
+	memory := config.MultipartMaxMemory
+	values := map[string][]string{}
+	received := map[string][]*MultipartFile{}
+	// the files are only removed by the handler once bound
+	defer func() {
+		if errorResponse != nil {
+			for _, list := range received {
+				for _, file := range list {
+					file.remove()
+				}
+			}
+		}
+	}()
+	reader := multipart.NewReader(http.MaxBytesReader(nil, request.Body, config.MultipartMaxSize), boundary)
+	fileCount := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return multipartReadError(err)
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		// counted before any file is read, even the skipped ones
+		if part.FileName() != "" {
+			if fileCount++; fileCount > config.MultipartMaxFiles {
+				return &ServerErrorResponse{
+					Cause:  exception.String("Multipart form has too many files"),
+					Status: http.StatusRequestEntityTooLarge,
+				}
+			}
+		}
+		// a file part, or a value of a file field
+		if file, exists := files[name]; exists {
+			if part.FileName() == "" || !file.slice && len(received[name]) > 0 {
+				return &ServerErrorResponse{
+					Cause:  exception.String("Multipart field " + strconv.Quote(name) + " must be a single file"),
+					Status: http.StatusBadRequest,
+				}
+			}
+			receivedFile, errorResponse := receiveMultipartFile(part, file, config, &memory)
+			if errorResponse != nil {
+				return errorResponse
+			}
+			received[name] = append(received[name], receivedFile)
+			continue
+		}
+		// unknown files are skipped
+		if part.FileName() != "" {
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, memory+1))
+		if err != nil {
+			return multipartReadError(err)
+		}
+		if memory -= int64(len(value)); memory < 0 {
+			return &ServerErrorResponse{
+				Cause:  exception.String("Multipart form values are too large"),
+				Status: http.StatusRequestEntityTooLarge,
+			}
+		}
+		values[name] = append(values[name], string(value))
+	}
+	// bind the values like a form, then the files
+	if err := bind("multipart", values, parsed); err != nil {
+		return &ServerErrorResponse{
+			Cause:  exception.String("Bind multipart values failed").AddCause(err),
+			Status: http.StatusBadRequest,
+		}
+	}
+	parsedValue := reflect.ValueOf(parsed).Elem()
+	for name, list := range received {
+		file := files[name]
+		if file.slice {
+			parsedValue.Field(file.index).Set(reflect.ValueOf(list))
+		} else {
+			parsedValue.Field(file.index).Set(reflect.ValueOf(list[0]))
+		}
+	}
+	return nil
+}
+
+func receiveMultipartFile(
+	part *multipart.Part,
+	field *multipartFileField,
+	config *MultipartConfig,
+	memory *int64,
+) (*MultipartFile, *ServerErrorResponse) {
+	maxSize := field.maxSize
+	if maxSize == 0 {
+		maxSize = config.MultipartMaxFileSize
+	}
+	// sniff the content type from the first bytes
+	head := make([]byte, 512)
+	count, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, multipartReadError(err)
+	}
+	head = head[:count]
+	file := &MultipartFile{
+		Filename:    part.FileName(),
+		Header:      part.Header,
+		ContentType: http.DetectContentType(head),
+	}
+	if len(field.accept) > 0 {
+		if mediaType, _, _ := mime.ParseMediaType(file.ContentType); !matchMediaType(mediaType, field.accept) {
+			return nil, &ServerErrorResponse{
+				Cause:  exception.String("File type " + strconv.Quote(mediaType) + " is not allowed"),
+				Status: http.StatusUnsupportedMediaType,
+			}
+		}
+	}
+	tooLarge := &ServerErrorResponse{
+		Cause:  exception.String("File " + strconv.Quote(file.Filename) + " is too large"),
+		Status: http.StatusRequestEntityTooLarge,
+	}
+	content := io.LimitReader(io.MultiReader(bytes.NewReader(head), part), maxSize+1)
+	// keep the file in memory while it fits the budget
+	var buffer bytes.Buffer
+	size, err := io.CopyN(&buffer, content, max(*memory, 0)+1)
+	if err == io.EOF {
+		if size > maxSize {
+			return nil, tooLarge
+		}
+		*memory -= size
+		file.content, file.Size = buffer.Bytes(), size
+		return file, nil
+	}
+	if err != nil {
+		return nil, multipartReadError(err)
+	}
+	// spill to disk
+	spilled, err := os.CreateTemp(config.MultipartTempDir, "multipart-")
+	if err != nil {
+		return nil, &ServerErrorResponse{
+			Cause:  exception.String("Create spill file failed").AddCause(err),
+			Status: http.StatusInternalServerError,
+		}
+	}
+	file.path = spilled.Name()
+	size, err = io.Copy(spilled, io.MultiReader(&buffer, content))
+	if closeErr := spilled.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || size > maxSize {
+		file.remove()
+		if err != nil {
+			return nil, multipartReadError(err)
+		}
+		return nil, tooLarge
+	}
+	file.Size = size
+	return file, nil
+}
+
+func multipartReadError(err error) *ServerErrorResponse {
+	if maxBytesError := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesError) {
+		return &ServerErrorResponse{
+			Cause:  exception.String("Request body is too large").AddCause(err),
+			Status: http.StatusRequestEntityTooLarge,
+		}
+	}
+	return &ServerErrorResponse{
+		Cause:  exception.String("Read multipart body failed").AddCause(err),
+		Status: http.StatusBadRequest,
+	}
+}
+
+func (f *MultipartFile) remove() {
+	if f.path != "" {
+		_ = os.Remove(f.path)
+	}
+}
+
+// removeMultipartFiles removes the spilled files once the handler returned.
+func removeMultipartFiles(logger *zerolog.Logger, parsed any, files map[string]*multipartFileField) {
+	parsedValue := reflect.ValueOf(parsed).Elem()
+	for _, file := range files {
+		field := parsedValue.Field(file.index)
+		var list []*MultipartFile
+		if file.slice {
+			list = field.Interface().([]*MultipartFile)
+		} else if received := field.Interface().(*MultipartFile); received != nil {
+			list = []*MultipartFile{received}
+		}
+		for _, received := range list {
+			if received.path == "" {
+				continue
+			}
+			if err := os.Remove(received.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warn().Err(err).Str("path", received.path).Msg("Failed to remove spilled file")
+			}
+		}
+	}
+}
+
+//endregion bindMultipartForm
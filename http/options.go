@@ -0,0 +1,174 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/thanhminhmr/go-common/ratelimit"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Middleware = func(http.Handler) http.Handler
+
+type SlashHandling int
+
+const (
+	// SlashStrip strips the trailing slash before routing, the default.
+	SlashStrip SlashHandling = iota
+	// SlashRedirect redirects to the path without the trailing slash.
+	SlashRedirect
+	// SlashNone routes the path as is.
+	SlashNone
+)
+
+// ServerOption customizes the default middleware stack of NewServer, which is,
+// in order: the before middlewares, the instrumentation setting the request id,
+// the span and the metrics, the logger, the recovery, the compression,
+// the cors, the sessions, the authentication, the rate limit and the slash
+// handling. To use them with fx, annotate the variadic parameter of
+// NewServer with a value group tag through fx.ParamTags.
+type ServerOption func(options *serverOptions)
+
+type serverOptions struct {
+	before         []Middleware
+	instrument     Middleware
+	logger         Middleware
+	recovery       Middleware
+	compression    Middleware
+	cors           Middleware
+	sessions       Middleware
+	authentication Middleware
+	rateLimit      Middleware
+	slashes        SlashHandling
+	panicHooks     []PanicHook
+	// rate limit settings, the middleware is built after all options applied
+	rateLimitStore  ratelimit.Store
+	rateLimitKey    RateLimitKey
+	rateLimitRoutes map[string]ratelimit.Limit
+}
+
+// WithLogger replaces the logger middleware, which puts the request logger in
+// the context and logs the requests. A nil logger disables it, the request id,
+// the span and the metrics are kept.
+func WithLogger(logger Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.logger = logger
+	}
+}
+
+// WithRecovery replaces the panic recovery middleware. A nil recovery disables
+// it.
+func WithRecovery(recovery Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.recovery = recovery
+	}
+}
+
+// WithPanicHook adds hooks called by the default recovery with every recovered
+// panic, for example to report it to an error tracker.
+func WithPanicHook(hooks ...PanicHook) ServerOption {
+	return func(options *serverOptions) {
+		options.panicHooks = append(options.panicHooks, hooks...)
+	}
+}
+
+// WithCompression replaces the compression middleware configured by
+// ServerConfig. A nil compression disables it.
+func WithCompression(compression Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.compression = compression
+	}
+}
+
+// WithCors replaces the cors middleware configured by ServerConfig. A nil cors
+// disables it.
+func WithCors(cors Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.cors = cors
+	}
+}
+
+// WithAuthentication adds the middleware putting the authenticated Principal in
+// the request context, such as the one of the auth package. It runs before the
+// rate limit, so that the limit can be keyed by principal.
+func WithAuthentication(authentication Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.authentication = authentication
+	}
+}
+
+// WithRateLimitStore replaces the in-memory store of the rate limit, typically
+// with a store shared by all the instances.
+func WithRateLimitStore(store ratelimit.Store) ServerOption {
+	return func(options *serverOptions) {
+		options.rateLimitStore = store
+	}
+}
+
+// WithRateLimitKey replaces the key configured by ServerConfig.
+func WithRateLimitKey(key RateLimitKey) ServerOption {
+	return func(options *serverOptions) {
+		options.rateLimitKey = key
+	}
+}
+
+// WithRouteRateLimit overrides the rate limit of a route, given as a chi route
+// pattern optionally prefixed by a method, such as "POST /login". A route has
+// its own buckets, and the zero Limit makes it unlimited.
+func WithRouteRateLimit(route string, limit ratelimit.Limit) ServerOption {
+	return func(options *serverOptions) {
+		if options.rateLimitRoutes == nil {
+			options.rateLimitRoutes = map[string]ratelimit.Limit{}
+		}
+		options.rateLimitRoutes[route] = limit
+	}
+}
+
+func WithSlashes(slashes SlashHandling) ServerOption {
+	return func(options *serverOptions) {
+		options.slashes = slashes
+	}
+}
+
+// WithBefore adds middlewares that run before the logger, such as real ip
+// resolution or tracing.
+func WithBefore(middlewares ...Middleware) ServerOption {
+	return func(options *serverOptions) {
+		options.before = append(options.before, middlewares...)
+	}
+}
+
+func (o *serverOptions) middlewares() []Middleware {
+	middlewares := append([]Middleware{}, o.before...)
+	if o.instrument != nil {
+		middlewares = append(middlewares, o.instrument)
+	}
+	if o.logger != nil {
+		middlewares = append(middlewares, o.logger)
+	}
+	if o.recovery != nil {
+		middlewares = append(middlewares, o.recovery)
+	}
+	if o.compression != nil {
+		middlewares = append(middlewares, o.compression)
+	}
+	if o.cors != nil {
+		middlewares = append(middlewares, o.cors)
+	}
+	if o.sessions != nil {
+		middlewares = append(middlewares, o.sessions)
+	}
+	if o.authentication != nil {
+		middlewares = append(middlewares, o.authentication)
+	}
+	if o.rateLimit != nil {
+		middlewares = append(middlewares, o.rateLimit)
+	}
+	switch o.slashes {
+	case SlashStrip:
+		middlewares = append(middlewares, middleware.StripSlashes)
+	case SlashRedirect:
+		middlewares = append(middlewares, middleware.RedirectSlashes)
+	}
+	return middlewares
+}
@@ -0,0 +1,202 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerOutputResponse renders an output struct declared like a request, with
+// its fields tagged by where they are written:
+//
+//	type CreateUserOutput struct {
+//		Location string       `header:"Location"`
+//		Session  *http.Cookie `cookie:"session"`
+//		User     User         `json:""`
+//	}
+//
+// The header-tagged fields are written with fmt.Sprint, a slice as several
+// values and a time.Time in the HTTP date format, the zero values are skipped.
+// The cookie-tagged fields are either a *http.Cookie or an http.Cookie, named by
+// the tag unless they have a name, or a string as the value of a cookie of the
+// root path. The body is either the json-tagged field, or the codec-tagged
+// field negotiated like ServerCodecResponse with the optional media types of
+// its tag, such as `codec:"application/json;application/cbor"`. A nil body is
+// not written.
+type ServerOutputResponse struct {
+	Status int
+	Output any
+}
+
+func (r ServerOutputResponse) Render(writer http.ResponseWriter) error {
+	return r.RenderRequest(writer, &http.Request{Header: http.Header{}})
+}
+
+func (r ServerOutputResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	value := reflect.ValueOf(r.Output)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			panic("BUG: Output must not be nil")
+		}
+		value = value.Elem()
+	}
+	output := checkOutputConfiguration(value.Type())
+	for _, field := range output.headers {
+		writeOutputHeader(writer.Header(), field.name, value.Field(field.index))
+	}
+	for _, field := range output.cookies {
+		if cookie := outputCookie(field.name, value.Field(field.index)); cookie != nil {
+			http.SetCookie(writer, cookie)
+		}
+	}
+	if output.body == nil || isNilValue(value.Field(output.body.index)) {
+		writer.WriteHeader(r.Status)
+		return nil
+	}
+	body := value.Field(output.body.index).Interface()
+	if output.body.name == "json" {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writer.WriteHeader(r.Status)
+		return json.NewEncoder(writer).Encode(body)
+	}
+	return ServerCodecResponse{
+		Status:     r.Status,
+		Response:   body,
+		MediaTypes: output.body.mediaTypes,
+	}.RenderRequest(writer, request)
+}
+
+//region outputConfiguration
+
+type outputField struct {
+	index      int
+	name       string
+	mediaTypes []string
+}
+
+type outputConfiguration struct {
+	headers []outputField
+	cookies []outputField
+	body    *outputField
+}
+
+// outputConfigurations caches the configurations by output type.
+var outputConfigurations sync.Map
+
+func checkOutputConfiguration(outputType reflect.Type) *outputConfiguration {
+	if cached, exists := outputConfigurations.Load(outputType); exists {
+		return cached.(*outputConfiguration)
+	}
+	if outputType.Kind() != reflect.Struct {
+		panic("BUG: Output must be a struct")
+	}
+	output := &outputConfiguration{}
+	for index := range outputType.NumField() {
+		field := outputType.Field(index)
+		if name, exists := field.Tag.Lookup("header"); exists {
+			if name == "" {
+				panic("BUG: header tag value must not be empty")
+			}
+			output.headers = append(output.headers, outputField{index: index, name: name})
+		}
+		if name, exists := field.Tag.Lookup("cookie"); exists {
+			switch field.Type {
+			case reflect.TypeFor[*http.Cookie](), reflect.TypeFor[http.Cookie]():
+			case reflect.TypeFor[string]():
+				if name == "" {
+					panic("BUG: cookie tag value of a string field must not be empty")
+				}
+			default:
+				panic("BUG: cookie-tagged field must be a *http.Cookie, an http.Cookie or a string")
+			}
+			output.cookies = append(output.cookies, outputField{index: index, name: name})
+		}
+		if value, exists := field.Tag.Lookup("json"); exists {
+			if value != "" {
+				panic("BUG: json tag value must be empty")
+			}
+			if output.body != nil {
+				panic("BUG: multiple body fields are not allowed")
+			}
+			output.body = &outputField{index: index, name: "json"}
+		}
+		if mediaTypes, exists := field.Tag.Lookup("codec"); exists {
+			if output.body != nil {
+				panic("BUG: multiple body fields are not allowed")
+			}
+			output.body = &outputField{index: index, name: "codec"}
+			if mediaTypes != "" {
+				output.body.mediaTypes = strings.Split(mediaTypes, ";")
+			}
+		}
+	}
+	cached, _ := outputConfigurations.LoadOrStore(outputType, output)
+	return cached.(*outputConfiguration)
+}
+
+//endregion outputConfiguration
+
+//region output fields
+
+func isNilValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return value.IsNil()
+	default:
+		return false
+	}
+}
+
+func writeOutputHeader(header http.Header, name string, value reflect.Value) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		for index := range value.Len() {
+			writeOutputHeader(header, name, value.Index(index))
+		}
+		return
+	}
+	if value.IsZero() {
+		return
+	}
+	if date, ok := value.Interface().(time.Time); ok {
+		header.Add(name, date.UTC().Format(http.TimeFormat))
+		return
+	}
+	header.Add(name, fmt.Sprint(value.Interface()))
+}
+
+func outputCookie(name string, value reflect.Value) *http.Cookie {
+	var cookie http.Cookie
+	switch field := value.Interface().(type) {
+	case *http.Cookie:
+		if field == nil {
+			return nil
+		}
+		cookie = *field
+	case http.Cookie:
+		if field.Name == "" && field.Value == "" {
+			return nil
+		}
+		cookie = field
+	case string:
+		if field == "" {
+			return nil
+		}
+		cookie = http.Cookie{Value: field, Path: "/"}
+	}
+	if cookie.Name == "" {
+		cookie.Name = name
+	}
+	return &cookie
+}
+
+//endregion output fields
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"mime"
 	"mime/multipart"
@@ -14,9 +15,10 @@ import (
 
 	"github.com/thanhminhmr/go-common/internal"
 	"github.com/thanhminhmr/go-common/log"
+	"github.com/thanhminhmr/go-common/session"
+	"github.com/thanhminhmr/go-common/validation"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/rs/zerolog"
 	"github.com/thanhminhmr/go-exception"
@@ -42,6 +44,9 @@ func serverRequestHandler(
 	handler func() ServerResponse,
 ) {
 	logger := zerolog.Ctx(request.Context())
+	if tags.flags&tagMultipartForm != 0 {
+		defer removeMultipartFiles(logger, parsed, tags.multipartFiles)
+	}
 	if errorResponse := parseServerRequest(request, parsed, tags); errorResponse != nil {
 		logger.Error().Err(errorResponse).Msg("Failed to parse request")
 		if err := errorResponse.Render(writer); err != nil {
@@ -49,10 +54,10 @@ func serverRequestHandler(
 		}
 		return
 	}
-	logger.Trace().Any("request", parsed).Msg("Request parsed")
+	logger.Trace().Any("request", log.Redact(parsed)).Msg("Request parsed")
 	if renderer := handler(); renderer != nil {
 		log.FuncOrAny(logger.Trace(), "response", renderer).Msg("Response returned")
-		if err := renderer.Render(writer); err != nil {
+		if err := renderResponse(writer, request, renderer); err != nil {
 			logger.Error().Err(err).Msg("Failed to render response")
 		}
 	} else {
@@ -69,6 +74,13 @@ type serverRequestConfiguration struct {
 	multipartFieldIndex int
 	bodyFieldIndex      int
 	bodyContentTypes    []string
+	authFieldIndex      int
+	authRequired        bool
+	multipartFiles      map[string]*multipartFileField
+	codecFieldIndex     int
+	codecTypes          []string
+	queryStyles         map[string]QueryStyle
+	sessionFieldIndex   int
 }
 
 const (
@@ -80,6 +92,10 @@ const (
 	tagJson
 	tagMultipart
 	tagBody
+	tagAuth
+	tagMultipartForm
+	tagCodec
+	tagSession
 )
 
 func checkServerRequestConfiguration[ServerRequest any]() serverRequestConfiguration {
@@ -100,10 +116,17 @@ func checkServerRequestConfiguration[ServerRequest any]() serverRequestConfigura
 				tags.flags = tags.flags | tagCookie
 			}
 		}
-		if tags.flags&tagQuery == 0 {
-			if _, exists := field.Tag.Lookup("query"); exists {
-				tags.flags = tags.flags | tagQuery
+		if name, exists := field.Tag.Lookup("query"); exists {
+			tags.flags = tags.flags | tagQuery
+			if style := checkQueryStyle(field); style != "" {
+				if tags.queryStyles == nil {
+					tags.queryStyles = map[string]QueryStyle{}
+				}
+				name, _, _ = strings.Cut(name, ",")
+				tags.queryStyles[name] = style
 			}
+		} else {
+			checkQueryStyle(field)
 		}
 		if tags.flags&tagUrl == 0 {
 			if _, exists := field.Tag.Lookup("url"); exists {
@@ -126,17 +149,28 @@ func checkServerRequestConfiguration[ServerRequest any]() serverRequestConfigura
 			tags.jsonFieldIndex = index
 		}
 		if value, exists := field.Tag.Lookup("multipart"); exists {
-			if value != "" {
-				panic("BUG: multipart tag value must be empty")
-			}
-			if tags.flags&tagMultipart != 0 {
-				panic("BUG: multiple multipart-tagged fields are not allowed")
+			if value == "" {
+				// streaming mode, the handler reads the parts itself
+				if tags.flags&tagMultipart != 0 {
+					panic("BUG: multiple multipart-tagged fields are not allowed")
+				}
+				if field.Type != reflect.TypeFor[*multipart.Reader]() {
+					panic("BUG: multipart-tagged field without a name must be a *multipart.Reader")
+				}
+				tags.flags = tags.flags | tagMultipart
+				tags.multipartFieldIndex = index
+			} else {
+				tags.flags = tags.flags | tagMultipartForm
+				if file := checkMultipartFileField(field, index, value); file != nil {
+					if tags.multipartFiles == nil {
+						tags.multipartFiles = map[string]*multipartFileField{}
+					}
+					tags.multipartFiles[file.name] = file
+				}
 			}
-			if field.Type != reflect.TypeFor[multipart.Reader]() {
-				panic("BUG: multipart-tagged field must be a multipart.Reader")
+			if tags.flags&tagMultipart != 0 && tags.flags&tagMultipartForm != 0 {
+				panic("BUG: multipart streaming and binding are not allowed together")
 			}
-			tags.flags = tags.flags | tagMultipart
-			tags.multipartFieldIndex = index
 		}
 		if contentTypes, exists := field.Tag.Lookup("body"); exists {
 			if tags.flags&tagBody != 0 {
@@ -149,6 +183,43 @@ func checkServerRequestConfiguration[ServerRequest any]() serverRequestConfigura
 			tags.bodyFieldIndex = index
 			tags.bodyContentTypes = strings.Split(contentTypes, ";")
 		}
+		if mediaTypes, exists := field.Tag.Lookup("codec"); exists {
+			if tags.flags&tagCodec != 0 {
+				panic("BUG: multiple codec-tagged fields are not allowed")
+			}
+			tags.flags = tags.flags | tagCodec
+			tags.codecFieldIndex = index
+			if mediaTypes != "" {
+				tags.codecTypes = strings.Split(mediaTypes, ";")
+			}
+		}
+		if value, exists := field.Tag.Lookup("auth"); exists {
+			if value != "" && value != "required" {
+				panic("BUG: auth tag value must be empty or required")
+			}
+			if tags.flags&tagAuth != 0 {
+				panic("BUG: multiple auth-tagged fields are not allowed")
+			}
+			if field.Type != reflect.TypeFor[*Principal]() {
+				panic("BUG: auth-tagged field must be a *Principal")
+			}
+			tags.flags = tags.flags | tagAuth
+			tags.authFieldIndex = index
+			tags.authRequired = value == "required"
+		}
+		if value, exists := field.Tag.Lookup("session"); exists {
+			if value != "" {
+				panic("BUG: session tag value must be empty")
+			}
+			if tags.flags&tagSession != 0 {
+				panic("BUG: multiple session-tagged fields are not allowed")
+			}
+			if field.Type != reflect.TypeFor[*session.Session]() {
+				panic("BUG: session-tagged field must be a *session.Session")
+			}
+			tags.flags = tags.flags | tagSession
+			tags.sessionFieldIndex = index
+		}
 	}
 	return tags
 }
@@ -157,9 +228,19 @@ func checkServerRequestConfiguration[ServerRequest any]() serverRequestConfigura
 
 //region parseServerRequest
 
-var serverRequestValidator = validator.New(validator.WithRequiredStructEnabled())
-
 func parseServerRequest(request *http.Request, parsed any, tags serverRequestConfiguration) (errorResponse *ServerErrorResponse) {
+	// bind the authenticated principal
+	if tags.flags&tagAuth != 0 {
+		if err := bindAuth(request, parsed, tags.authFieldIndex, tags.authRequired); err != nil {
+			return err
+		}
+	}
+	// bind the session
+	if tags.flags&tagSession != 0 {
+		if err := bindSession(request, parsed, tags.sessionFieldIndex); err != nil {
+			return err
+		}
+	}
 	// parse and bind request header
 	if tags.flags&tagHeader != 0 {
 		if err := bindHeader(request, parsed); err != nil {
@@ -174,7 +255,7 @@ func parseServerRequest(request *http.Request, parsed any, tags serverRequestCon
 	}
 	// parse and bind url query values
 	if tags.flags&tagQuery != 0 {
-		if err := bindQuery(request, parsed); err != nil {
+		if err := bindQuery(request, parsed, tags.queryStyles); err != nil {
 			return err
 		}
 	}
@@ -184,16 +265,10 @@ func parseServerRequest(request *http.Request, parsed any, tags serverRequestCon
 			return err
 		}
 	}
-	// validate body later
+	// normalize and validate body later
 	defer func() {
-		if errorResponse != nil {
-			return
-		}
-		if err := serverRequestValidator.Struct(parsed); err != nil {
-			errorResponse = &ServerErrorResponse{
-				Cause:  exception.String("Request body is not valid").AddCause(err),
-				Status: http.StatusBadRequest,
-			}
+		if errorResponse == nil {
+			errorResponse = validateServerRequest(request, parsed)
 		}
 	}()
 	// parse and bind body
@@ -222,7 +297,17 @@ func parseServerRequest(request *http.Request, parsed any, tags serverRequestCon
 		if tags.flags&tagJson != 0 && contentType == "application/json" {
 			return bindJson(request, parsed, tags.jsonFieldIndex)
 		}
+		// decode request body with a registered codec
+		if tags.flags&tagCodec != 0 && (tags.codecTypes == nil || matchMediaType(contentType, tags.codecTypes)) {
+			if codec := LookupCodec(contentType); codec != nil {
+				return bindCodec(request, parsed, tags.codecFieldIndex, codec)
+			}
+		}
 		// parse and bind request body as multipart form
+		if tags.flags&tagMultipartForm != 0 && contentType == "multipart/form-data" {
+			return bindMultipartForm(request, parsed, tags.multipartFiles, contentTypeParameters)
+		}
+		// stream request body as multipart form
 		if tags.flags&tagMultipart != 0 && contentType == "multipart/form-data" {
 			return bindMultipart(request, parsed, tags.multipartFieldIndex, contentTypeParameters)
 		}
@@ -240,6 +325,18 @@ func parseServerRequest(request *http.Request, parsed any, tags serverRequestCon
 	return nil
 }
 
+func bindAuth(request *http.Request, parsed any, fieldIndex int, required bool) *ServerErrorResponse {
+	principal := PrincipalFromContext(request.Context())
+	if principal == nil {
+		if required {
+			return Unauthorized(request, ErrUnauthenticated)
+		}
+		return nil
+	}
+	reflect.ValueOf(parsed).Elem().Field(fieldIndex).Set(reflect.ValueOf(principal))
+	return nil
+}
+
 func bindHeader(request *http.Request, parsed any) *ServerErrorResponse {
 	// parse and bind request header
 	if len(request.Header) > 0 {
@@ -270,10 +367,10 @@ func bindCookie(request *http.Request, parsed any) *ServerErrorResponse {
 	return nil
 }
 
-func bindQuery(request *http.Request, parsed any) *ServerErrorResponse {
+func bindQuery(request *http.Request, parsed any, styles map[string]QueryStyle) *ServerErrorResponse {
 	// parse and bind url query values
 	if values := request.URL.Query(); len(values) > 0 {
-		if err := bind("query", values, parsed); err != nil {
+		if err := bind("query", queryInput(values, styles), parsed); err != nil {
 			return &ServerErrorResponse{
 				Cause:  exception.String("Bind query values failed").AddCause(err),
 				Status: http.StatusInternalServerError,
@@ -375,3 +472,64 @@ func bind(tag string, input any, output any) error {
 }
 
 //endregion parseServerRequest
+
+//region validateServerRequest
+
+// RequestNormalizer is implemented by the requests normalizing their inputs,
+// such as trimming and lowercasing, once bound and before being validated.
+type RequestNormalizer interface {
+	Normalize()
+}
+
+// RequestValidator is implemented by the requests needing the checks that the
+// validate tags cannot express, such as querying the database. Validate is
+// only called once the tags are validated, so it can rely on their
+// constraints. A validation.FieldErrors is answered as 400 Bad Request with
+// its fields, a ServerErrorResponse is answered as is, and other errors are
+// answered as an internal error.
+type RequestValidator interface {
+	Validate(ctx context.Context) error
+}
+
+func validateServerRequest(request *http.Request, parsed any) *ServerErrorResponse {
+	if normalizer, ok := parsed.(RequestNormalizer); ok {
+		normalizer.Normalize()
+	}
+	acceptLanguage := request.Header.Get("Accept-Language")
+	var cause error
+	var fields []validation.FieldError
+	if err := validation.StructCtx(request.Context(), parsed); err != nil {
+		cause = err
+		fields = validation.Translate(err, acceptLanguage)
+	} else if validator, ok := parsed.(RequestValidator); ok {
+		if err := validator.Validate(request.Context()); err != nil {
+			var fieldErrors validation.FieldErrors
+			var errorResponse ServerErrorResponse
+			var errorResponsePointer *ServerErrorResponse
+			switch {
+			case errors.As(err, &fieldErrors):
+				cause = err
+				fields = fieldErrors
+			case errors.As(err, &errorResponse):
+				return &errorResponse
+			case errors.As(err, &errorResponsePointer):
+				return errorResponsePointer
+			default:
+				return &ServerErrorResponse{
+					Cause:  exception.String("Validate request failed").AddCause(err),
+					Status: http.StatusInternalServerError,
+				}
+			}
+		}
+	}
+	if cause == nil {
+		return nil
+	}
+	return &ServerErrorResponse{
+		Cause:  exception.String("Request body is not valid").AddCause(cause),
+		Status: http.StatusBadRequest,
+		Fields: fields,
+	}
+}
+
+//endregion validateServerRequest
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	// Method is the authentication method, such as "jwt", "api_key" or
+	// "basic".
+	Method string
+	Scopes []string
+	Roles  []string
+	// Claims are the verified claims of a token, if any.
+	Claims map[string]any `log:"-"`
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller, or nil for anonymous
+// requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+type challengesKey struct{}
+
+// ContextWithChallenges sets the WWW-Authenticate values of the authentication
+// middleware, sent with every 401 Unauthorized response.
+func ContextWithChallenges(ctx context.Context, challenges []string) context.Context {
+	return context.WithValue(ctx, challengesKey{}, challenges)
+}
+
+const (
+	ErrUnauthenticated  = exception.String("Authentication is required")
+	ErrPermissionDenied = exception.String("Permission denied")
+)
+
+// Unauthorized returns the 401 Unauthorized response of the request, for a
+// missing or invalid authentication.
+func Unauthorized(request *http.Request, cause error) *ServerErrorResponse {
+	response := &ServerErrorResponse{
+		Status:    http.StatusUnauthorized,
+		Cause:     cause,
+		RequestID: RequestID(request.Context()),
+	}
+	if challenges, _ := request.Context().Value(challengesKey{}).([]string); len(challenges) > 0 {
+		response.Header = http.Header{"Www-Authenticate": challenges}
+	}
+	return response
+}
+
+// Forbidden returns the 403 Forbidden response of the request, for a principal
+// that is not allowed.
+func Forbidden(request *http.Request, cause error) *ServerErrorResponse {
+	return &ServerErrorResponse{
+		Status:    http.StatusForbidden,
+		Cause:     cause,
+		RequestID: RequestID(request.Context()),
+	}
+}
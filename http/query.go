@@ -0,0 +1,120 @@
+package http
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// QueryStyle is the serialization of a query parameter, declared by the style
+// tag of a query-tagged field, as the styles of OpenAPI:
+//
+//	IDs    []int  `query:"ids" style:"comma"`       // ?ids=1,2,3
+//	Filter Filter `query:"filter" style:"deepObject"` // ?filter[status]=active
+type QueryStyle string
+
+const (
+	// QueryStyleForm repeats the parameter for every value, the default, as in
+	// "?ids=1&ids=2".
+	QueryStyleForm QueryStyle = "form"
+	// QueryStyleComma separates the values with commas, as in "?ids=1,2".
+	QueryStyleComma QueryStyle = "comma"
+	// QueryStylePipe separates the values with pipes, as in "?ids=1|2".
+	QueryStylePipe QueryStyle = "pipe"
+	// QueryStyleSpace separates the values with spaces, as in "?ids=1%202".
+	QueryStyleSpace QueryStyle = "space"
+	// QueryStyleDeepObject binds a struct or a map from bracketed keys, which
+	// may be nested, as in "?filter[status]=active&filter[date][from]=2020".
+	QueryStyleDeepObject QueryStyle = "deepObject"
+)
+
+var queryStyleSeparators = map[QueryStyle]string{
+	QueryStyleComma: ",",
+	QueryStylePipe:  "|",
+	QueryStyleSpace: " ",
+}
+
+// checkQueryStyle returns the style of a query-tagged field, or the empty
+// style for the default form style.
+func checkQueryStyle(field reflect.StructField) QueryStyle {
+	value, exists := field.Tag.Lookup("style")
+	if !exists {
+		return ""
+	}
+	if _, exists := field.Tag.Lookup("query"); !exists {
+		panic("BUG: style tag is only allowed on a query-tagged field")
+	}
+	fieldType := field.Type
+	for fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	switch style := QueryStyle(value); style {
+	case QueryStyleForm:
+		return ""
+	case QueryStyleComma, QueryStylePipe, QueryStyleSpace:
+		if fieldType.Kind() != reflect.Slice && fieldType.Kind() != reflect.Array {
+			panic("BUG: " + value + "-styled field must be a slice or an array")
+		}
+		return style
+	case QueryStyleDeepObject:
+		if fieldType.Kind() != reflect.Struct && fieldType.Kind() != reflect.Map {
+			panic("BUG: deepObject-styled field must be a struct or a map")
+		}
+		return style
+	default:
+		panic("BUG: style tag value must be form, comma, pipe, space or deepObject")
+	}
+}
+
+// queryInput converts the query values to the input of the binding, splitting
+// the delimited values and nesting the deep objects. The leaves are always
+// slices of strings, so that binding a slice does not depend on the count.
+func queryInput(values map[string][]string, styles map[string]QueryStyle) map[string]any {
+	input := make(map[string]any, len(values))
+	// sorted, so that the conflicting deep object keys are deterministic
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		list := values[key]
+		name, path, bracketed := strings.Cut(key, "[")
+		if bracketed && styles[name] == QueryStyleDeepObject {
+			setDeepObject(input, name, path, list)
+			continue
+		}
+		if separator, exists := queryStyleSeparators[styles[key]]; exists {
+			var split []string
+			for _, value := range list {
+				if value != "" {
+					split = append(split, strings.Split(value, separator)...)
+				}
+			}
+			input[key] = split
+			continue
+		}
+		if styles[key] == QueryStyleDeepObject {
+			// a deep object without brackets is not bound
+			continue
+		}
+		input[key] = list
+	}
+	return input
+}
+
+// setDeepObject sets the values at the bracketed path, such as "a][b]" for
+// the key "name[a][b]".
+func setDeepObject(input map[string]any, name string, path string, list []string) {
+	parent, key := input, name
+	for segment := range strings.SplitSeq(strings.TrimSuffix(path, "]"), "][") {
+		if segment == "" {
+			// "ids[]" appends to ids
+			continue
+		}
+		child, ok := parent[key].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			parent[key] = child
+		}
+		parent, key = child, segment
+	}
+	existing, _ := parent[key].([]string)
+	parent[key] = append(existing, list...)
+}
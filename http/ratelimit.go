@@ -0,0 +1,222 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+	"github.com/thanhminhmr/go-common/metrics"
+	"github.com/thanhminhmr/go-common/ratelimit"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// RateLimitConfig configures the default rate limit of the server. The key is
+// either "ip", "principal" or "header:<name>", the last two falling back to
+// the ip for requests without a principal or without the header.
+type RateLimitConfig struct {
+	RateLimit       uint32 `env:"HTTP_SERVER_RATE_LIMIT"`
+	RateLimitPeriod uint32 `env:"HTTP_SERVER_RATE_LIMIT_PERIOD" validate:"min=1,max=86400"`
+	RateLimitBurst  uint32 `env:"HTTP_SERVER_RATE_LIMIT_BURST"`
+	RateLimitKey    string `env:"HTTP_SERVER_RATE_LIMIT_KEY" validate:"oneof=ip principal|startswith=header:"`
+}
+
+func init() {
+	configuration.SetDefault("HTTP_SERVER_RATE_LIMIT", "0")
+	configuration.SetDefault("HTTP_SERVER_RATE_LIMIT_PERIOD", "60")
+	configuration.SetDefault("HTTP_SERVER_RATE_LIMIT_BURST", "0")
+	configuration.SetDefault("HTTP_SERVER_RATE_LIMIT_KEY", "ip")
+}
+
+func (c *RateLimitConfig) limit() ratelimit.Limit {
+	return ratelimit.Limit{
+		Requests: c.RateLimit,
+		Period:   time.Duration(c.RateLimitPeriod) * time.Second,
+		Burst:    c.RateLimitBurst,
+	}
+}
+
+func (c *RateLimitConfig) key(trusted []netip.Prefix) RateLimitKey {
+	byIP := RateLimitByIP(trusted)
+	switch {
+	case c.RateLimitKey == "principal":
+		return RateLimitByPrincipal(byIP)
+	case strings.HasPrefix(c.RateLimitKey, "header:"):
+		return RateLimitByHeader(strings.TrimPrefix(c.RateLimitKey, "header:"), byIP)
+	default:
+		return byIP
+	}
+}
+
+//region keys
+
+// RateLimitKey returns the bucket of the request, requests with an empty key
+// are not limited.
+type RateLimitKey func(request *http.Request) string
+
+func RateLimitByIP(trusted []netip.Prefix) RateLimitKey {
+	return func(request *http.Request) string {
+		return "ip:" + ClientIP(request, trusted)
+	}
+}
+
+func RateLimitByHeader(name string, fallback RateLimitKey) RateLimitKey {
+	return func(request *http.Request) string {
+		if value := request.Header.Get(name); value != "" {
+			return "header:" + value
+		}
+		if fallback != nil {
+			return fallback(request)
+		}
+		return ""
+	}
+}
+
+func RateLimitByPrincipal(fallback RateLimitKey) RateLimitKey {
+	return func(request *http.Request) string {
+		if principal := PrincipalFromContext(request.Context()); principal != nil {
+			return "principal:" + principal.Subject
+		}
+		if fallback != nil {
+			return fallback(request)
+		}
+		return ""
+	}
+}
+
+//endregion keys
+
+var serverRateLimited = metrics.NewCounter(
+	"http_server_rate_limited_total",
+	"Number of http requests denied by a rate limit, labeled by policy.",
+	"policy",
+)
+
+// RateLimit creates a middleware limiting the requests with the limiter, for
+// routes that need a limit but the server has none, or a second one. The
+// policy names the buckets of the limiter in its store and in the metrics, the
+// limiters sharing a store must have distinct policies.
+func RateLimit(policy string, limiter *ratelimit.Limiter, key RateLimitKey) Middleware {
+	if policy == "" || limiter == nil || key == nil {
+		panic("BUG: policy, limiter and key must not be empty")
+	}
+	return (&rateLimiter{key: key, fallback: limiter, policy: "middleware " + policy}).handler
+}
+
+// rateLimiter applies the default limit, or the limit of the route when there
+// is one. The route is found before routing, so that the limit is applied as
+// early as possible.
+type rateLimiter struct {
+	key      RateLimitKey
+	fallback *ratelimit.Limiter
+	policy   string // of the fallback
+	router   *chi.Mux
+	routes   map[string]*ratelimit.Limiter // nil means unlimited
+}
+
+func newRateLimiter(
+	router *chi.Mux,
+	config *RateLimitConfig,
+	trusted []netip.Prefix,
+	options *serverOptions,
+) Middleware {
+	if config.RateLimit == 0 && len(options.rateLimitRoutes) == 0 {
+		return nil
+	}
+	store := options.rateLimitStore
+	if store == nil {
+		store = ratelimit.NewMemoryStore()
+	}
+	key := options.rateLimitKey
+	if key == nil {
+		key = config.key(trusted)
+	}
+	limiter := &rateLimiter{key: key, policy: "default", router: router}
+	if limit := config.limit(); !limit.IsZero() {
+		limiter.fallback = ratelimit.NewLimiter(store, limit)
+	}
+	if len(options.rateLimitRoutes) > 0 {
+		limiter.routes = make(map[string]*ratelimit.Limiter, len(options.rateLimitRoutes))
+		for route, limit := range options.rateLimitRoutes {
+			if limit.IsZero() {
+				limiter.routes[route] = nil
+			} else {
+				limiter.routes[route] = ratelimit.NewLimiter(store, limit)
+			}
+		}
+	}
+	return limiter.handler
+}
+
+// find returns the limiter of the request and its policy name.
+func (l *rateLimiter) find(request *http.Request) (*ratelimit.Limiter, string) {
+	if len(l.routes) > 0 {
+		path := request.URL.Path
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		if pattern := l.router.Find(chi.NewRouteContext(), request.Method, path); pattern != "" {
+			if limiter, exists := l.routes[request.Method+" "+pattern]; exists {
+				return limiter, request.Method + " " + pattern
+			}
+			if limiter, exists := l.routes[pattern]; exists {
+				return limiter, pattern
+			}
+		}
+	}
+	return l.fallback, l.policy
+}
+
+func (l *rateLimiter) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		limiter, policy := l.find(request)
+		if limiter == nil {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		key := l.key(request)
+		if key == "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		result, err := limiter.Allow(request.Context(), policy+" "+key)
+		if err != nil {
+			// an unavailable store must not take the service down
+			zerolog.Ctx(request.Context()).Error().Err(err).Str("policy", policy).Msg("Failed to apply rate limit")
+			next.ServeHTTP(writer, request)
+			return
+		}
+		limit := limiter.Limit()
+		header := writer.Header()
+		header.Set("RateLimit-Policy", strconv.FormatUint(uint64(result.Limit), 10)+
+			";w="+strconv.FormatInt(int64(limit.Period/time.Second), 10))
+		header.Set("RateLimit-Limit", strconv.FormatUint(uint64(result.Limit), 10))
+		header.Set("RateLimit-Remaining", strconv.FormatUint(uint64(result.Remaining), 10))
+		header.Set("RateLimit-Reset", seconds(result.ResetAfter))
+		if result.Allowed {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		serverRateLimited.With(policy).Inc()
+		header.Set("Retry-After", seconds(result.RetryAfter))
+		response := ServerErrorResponse{
+			Status:    http.StatusTooManyRequests,
+			Cause:     exception.String("Too many requests"),
+			RequestID: RequestID(request.Context()),
+		}
+		if err := response.Render(writer); err != nil {
+			zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render error")
+		}
+	})
+}
+
+// seconds rounds up, so that a client retrying after it is never too early.
+func seconds(duration time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(duration.Seconds())), 10)
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// PanicHook is called with every panic recovered from a handler.
+type PanicHook func(request *http.Request, recovered exception.Exception)
+
+func (s *httpServer) recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		wrappedWriter := &recoveryWriter{ResponseWriter: writer}
+		// recover any panic
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// the handler asked to abort the connection, let net/http do it
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+			exceptional := exception.Recover(recovered)
+			logger := s.requestLogger(request)
+			logger.Error().Err(exceptional).Msg("Recovered from panic")
+			s.reportPanic(request, exceptional)
+			// a started response cannot be turned into an error response anymore
+			if wrappedWriter.started || wrappedWriter.hijacked || isUpgrade(request) {
+				logger.Warn().Msg("Response already started, aborting the connection")
+				panic(http.ErrAbortHandler)
+			}
+			// response with 500 Internal Server Error, without the headers of the
+			// failed response
+			resetHeader(wrappedWriter.Header())
+			response := ServerErrorResponse{
+				Status:    http.StatusInternalServerError,
+				Cause:     exception.String("Internal server error"),
+				RequestID: RequestID(request.Context()),
+			}
+			if err := response.Render(wrappedWriter); err != nil {
+				logger.Error().Err(err).Msg("Failed to render error")
+			}
+		}()
+		// call the next handler
+		next.ServeHTTP(wrappedWriter, request)
+	})
+}
+
+func (s *httpServer) reportPanic(request *http.Request, recovered exception.Exception) {
+	for _, hook := range s.panicHooks {
+		func() {
+			defer func() {
+				if failed := exception.Recover(recover()); failed != nil {
+					s.requestLogger(request).Error().Err(failed).Msg("Panic hook failed")
+				}
+			}()
+			hook(request, recovered)
+		}()
+	}
+}
+
+func isUpgrade(request *http.Request) bool {
+	for _, value := range request.Header.Values("Connection") {
+		for token := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recoveryWriter tracks whether the response has started, so that the recovery
+// knows if an error response can still be written.
+type recoveryWriter struct {
+	http.ResponseWriter
+	started  bool
+	hijacked bool
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	// informational responses, except switching protocols, do not commit
+	if status >= http.StatusOK || status == http.StatusSwitchingProtocols {
+		w.started = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(data []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recoveryWriter) ReadFrom(reader io.Reader) (int64, error) {
+	w.started = true
+	return io.Copy(w.ResponseWriter, reader)
+}
+
+func (w *recoveryWriter) Flush() {
+	w.started = true
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *recoveryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	connection, readWriter, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return connection, readWriter, err
+}
+
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
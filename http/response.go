@@ -3,6 +3,9 @@ package http
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+
+	"github.com/thanhminhmr/go-common/validation"
 
 	"github.com/rs/zerolog"
 )
@@ -11,6 +14,35 @@ type ServerResponse interface {
 	Render(writer http.ResponseWriter) error
 }
 
+// ServerRequestResponse is a ServerResponse also depending on the request, such
+// as the conditional and range requests of a file. The handlers of
+// ServerRequestParser render it with the request, Render renders it as for a
+// plain GET request.
+type ServerRequestResponse interface {
+	ServerResponse
+	RenderRequest(writer http.ResponseWriter, request *http.Request) error
+}
+
+// renderResponse renders the response with the request if it depends on it.
+func renderResponse(writer http.ResponseWriter, request *http.Request, response ServerResponse) error {
+	if requestResponse, ok := response.(ServerRequestResponse); ok {
+		return requestResponse.RenderRequest(writer, request)
+	}
+	return response.Render(writer)
+}
+
+// addVary adds a header name to Vary, unless already listed.
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for listed := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(listed), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
 type ServerResponseFunc func(writer http.ResponseWriter) error
 
 func (fn ServerResponseFunc) Render(writer http.ResponseWriter) error {
@@ -18,25 +50,54 @@ func (fn ServerResponseFunc) Render(writer http.ResponseWriter) error {
 }
 
 type ServerErrorResponse struct {
-	Status int
-	Cause  error
+	Status    int
+	Cause     error
+	RequestID string
+	// Header is added to the response, such as WWW-Authenticate.
+	Header http.Header
+	// Fields are the errors of the invalid fields, rendered after the cause.
+	Fields []validation.FieldError
 }
 
 func (e ServerErrorResponse) Render(writer http.ResponseWriter) error {
 	header := writer.Header()
-	header.Add("Content-Type", "text/plain; charset=utf-8")
-	header.Add("X-Content-Type-Options", "nosniff")
+	for key, values := range e.Header {
+		header[key] = append(header[key], values...)
+	}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
 	writer.WriteHeader(e.Status)
-	_, err := writer.Write([]byte(e.Cause.Error()))
+	body := e.Cause.Error()
+	for _, field := range e.Fields {
+		body += "\n" + field.Error()
+	}
+	if e.RequestID != "" {
+		body += "\nRequest ID: " + e.RequestID
+	}
+	_, err := writer.Write([]byte(body))
 	return err
 }
 
+// resetHeader clears the headers set for a response replaced by an error, such
+// as Content-Encoding or Set-Cookie, keeping the request ID and the CORS headers
+// so that the client can still read the error.
+func resetHeader(header http.Header) {
+	for key := range header {
+		if key != http.CanonicalHeaderKey(headerRequestID) && key != "Vary" && !strings.HasPrefix(key, "Access-Control-") {
+			delete(header, key)
+		}
+	}
+}
+
 func (e ServerErrorResponse) Error() string {
 	return e.Cause.Error()
 }
 
 func (e ServerErrorResponse) MarshalZerologObject(event *zerolog.Event) {
 	event.AnErr("cause", e.Cause).Int("Status", e.Status)
+	if e.RequestID != "" {
+		event.Str("request_id", e.RequestID)
+	}
 }
 
 type ServerJsonResponse struct {
@@ -5,69 +5,156 @@ import (
 	"errors"
 	"fmt"
 	"math/rand/v2"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/thanhminhmr/go-common/configuration"
 	"github.com/thanhminhmr/go-common/log"
+	"github.com/thanhminhmr/go-common/metrics"
+	"github.com/thanhminhmr/go-common/tracing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
-	"github.com/thanhminhmr/go-exception"
 	"go.uber.org/fx"
 )
 
 type ServerConfig struct {
-	Port              uint16 `env:"HTTP_SERVER_PORT" validate:"required"`
-	ReadHeaderTimeout uint32 `env:"HTTP_SERVER_READ_HEADER_TIMEOUT" validate:"min=0,max=60"`
-	IdleTimeout       uint32 `env:"HTTP_SERVER_IDLE_TIMEOUT" validate:"min=0,max=3600"`
-	MaxHeaderBytes    uint32 `env:"HTTP_SERVER_MAX_HEADER_BYTES" validate:"min=0,max=65536"`
-	ShutdownOnError   bool   `env:"HTTP_SERVER_SHUTDOWN_ON_ERROR"`
+	// Port is required, an explicit zero lets the operating system choose the
+	// port, see Server.Addr
+	Port              *uint16  `env:"HTTP_SERVER_PORT" validate:"required"`
+	ReadHeaderTimeout uint32   `env:"HTTP_SERVER_READ_HEADER_TIMEOUT" validate:"min=0,max=60"`
+	IdleTimeout       uint32   `env:"HTTP_SERVER_IDLE_TIMEOUT" validate:"min=0,max=3600"`
+	MaxHeaderBytes    uint32   `env:"HTTP_SERVER_MAX_HEADER_BYTES" validate:"min=0,max=65536"`
+	ShutdownOnError   bool     `env:"HTTP_SERVER_SHUTDOWN_ON_ERROR"`
+	TrustedProxies    []string `env:"HTTP_SERVER_TRUSTED_PROXIES" validate:"dive,cidr|ip"`
+	// access log, a single event per request in place of the request and
+	// response events
+	AccessLog            bool     `env:"HTTP_SERVER_ACCESS_LOG"`
+	AccessLogFormat      string   `env:"HTTP_SERVER_ACCESS_LOG_FORMAT" validate:"oneof=json common combined"`
+	AccessLogExcludes    []string `env:"HTTP_SERVER_ACCESS_LOG_EXCLUDES"`
+	AccessLogSuccessRate float64  `env:"HTTP_SERVER_ACCESS_LOG_SUCCESS_RATE" validate:"min=0,max=1"`
+	// cross-origin resource sharing, disabled by default
+	CorsConfig `env:",squash"`
+	// rate limit, disabled by default
+	RateLimitConfig `env:",squash"`
+	// response compression and request decompression, disabled by default
+	CompressionConfig `env:",squash"`
+	// multipart form binding
+	MultipartConfig `env:",squash"`
 }
 
 func init() {
 	configuration.SetDefault("HTTP_SERVER_READ_HEADER_TIMEOUT", "5")
 	configuration.SetDefault("HTTP_SERVER_IDLE_TIMEOUT", "60")
 	configuration.SetDefault("HTTP_SERVER_MAX_HEADER_BYTES", "4096")
+	configuration.SetDefault("HTTP_SERVER_ACCESS_LOG", "false")
+	configuration.SetDefault("HTTP_SERVER_ACCESS_LOG_FORMAT", "json")
+	configuration.SetDefault("HTTP_SERVER_ACCESS_LOG_EXCLUDES", "/healthz;/livez;/readyz;/metrics")
+	configuration.SetDefault("HTTP_SERVER_ACCESS_LOG_SUCCESS_RATE", "1")
+}
+
+// Server exposes the runtime state of the http server created by NewServer.
+type Server interface {
+	// Addr returns the address the server is bound to, or nil before it is
+	// started. This is useful when ServerConfig.Port is set to zero and the
+	// port is chosen by the operating system.
+	Addr() net.Addr
 }
 
 func NewServer(
 	ctx context.Context,
 	lifecycle fx.Lifecycle,
 	config *ServerConfig,
-) chi.Router {
+	options ...ServerOption,
+) (chi.Router, Server) {
+	if config.Port == nil {
+		panic("BUG: Port must not be nil")
+	}
 	// create route
 	router := chi.NewRouter()
 	// create the http server
-	server := httpServer{
-		logger: zerolog.Ctx(ctx),
-		router: router,
+	logger := zerolog.Ctx(ctx)
+	trusted := parseTrustedProxies(logger, config.TrustedProxies)
+	server := &httpServer{
+		logger:    logger,
+		router:    router,
+		port:      *config.Port,
+		access:    newAccessLogger(config, trusted),
+		stopping:  make(chan struct{}),
+		multipart: &config.MultipartConfig,
 		server: http.Server{
-			Addr:              fmt.Sprintf(":%d", config.Port),
 			Handler:           router,
 			ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeout) * time.Second,
 			IdleTimeout:       time.Duration(config.IdleTimeout) * time.Second,
 			MaxHeaderBytes:    int(config.MaxHeaderBytes),
 		},
 	}
-	// set a sane default middleware stack
-	router.Use(
-		server.log,
-		middleware.StripSlashes,
-	)
+	// let the long-lived responses know about the shutdown, which waits for them
+	server.server.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), serverKey{}, server)
+	}
+	server.server.RegisterOnShutdown(func() {
+		close(server.stopping)
+	})
+	// set a sane default middleware stack, unless replaced
+	stack := serverOptions{
+		instrument: server.instrument,
+		logger:     server.log,
+		recovery:   server.recovery,
+		slashes:    SlashStrip,
+	}
+	if config.Compression || config.RequestDecompression {
+		stack.compression = Compression(&config.CompressionConfig)
+	}
+	if config.CorsConfig.Enabled {
+		stack.cors = Cors(&config.CorsConfig)
+	}
+	for _, option := range options {
+		option(&stack)
+	}
+	stack.rateLimit = newRateLimiter(router, &config.RateLimitConfig, trusted, &stack)
+	server.panicHooks = stack.panicHooks
+	router.Use(stack.middlewares()...)
 	// add to lifecycle
 	lifecycle.Append(fx.Hook{
 		OnStart: server.onStart,
 		OnStop:  server.onStop,
 	})
-	return router
+	return router, server
 }
 
 type httpServer struct {
-	logger *zerolog.Logger
-	router *chi.Mux
-	server http.Server
+	logger     *zerolog.Logger
+	panicHooks []PanicHook
+	router     *chi.Mux
+	port       uint16
+	access     *accessLogger
+	stopping   chan struct{}
+	sockets    webSockets
+	multipart  *MultipartConfig
+	server     http.Server
+	listener   atomic.Pointer[net.TCPListener]
+}
+
+type serverKey struct{}
+
+// serverFromContext returns the server of the request, or nil when it is not
+// served by NewServer.
+func serverFromContext(ctx context.Context) *httpServer {
+	server, _ := ctx.Value(serverKey{}).(*httpServer)
+	return server
+}
+
+func (s *httpServer) Addr() net.Addr {
+	if listener := s.listener.Load(); listener != nil {
+		return listener.Addr()
+	}
+	return nil
 }
 
 func (s *httpServer) onStart(context.Context) error {
@@ -78,20 +165,31 @@ func (s *httpServer) onStart(context.Context) error {
 		return err
 	}
 	s.logger.Info().Msg("Listed all routes")
+	// create listener, so that bind errors abort the startup
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: int(s.port)})
+	if err != nil {
+		s.logger.Error().Err(err).Uint16("port", s.port).Msg("Failed to listen")
+		return err
+	}
+	s.listener.Store(listener)
 	// start the server
-	go s.serve()
+	go s.serve(listener)
 	return nil
 }
 
-func (s *httpServer) serve() {
-	s.logger.Info().Str("addr", s.server.Addr).Msgf("Start serving")
-	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+func (s *httpServer) serve(listener *net.TCPListener) {
+	s.logger.Info().Stringer("addr", listener.Addr()).Msgf("Start serving")
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Error().Err(err).Msg("Shutdown with error")
 	}
 }
 
 func (s *httpServer) onStop(ctx context.Context) error {
 	s.logger.Info().Msg("Shutting down...")
+	// hijacked connections are not awaited by the shutdown, close them first
+	if err := s.sockets.closeAll(ctx); err != nil {
+		s.logger.Warn().Err(err).Msg("WebSocket connections not closed in time")
+	}
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.logger.Error().Err(err).Msg("Shutdown with error")
 		return err
@@ -106,42 +204,188 @@ func (s *httpServer) dumpRoutes(
 	handler http.Handler,
 	middlewares ...func(http.Handler) http.Handler,
 ) error {
+	policy := "none"
+	if policies := routePolicies(handler, middlewares); len(policies) > 0 {
+		policy = strings.Join(policies, " & ")
+	}
 	s.logger.Info().
 		Stringer("handler", log.Func(handler)).
 		Array("middlewares", log.Funcs(middlewares)).
+		Str("policy", policy).
 		Msgf("Route: %s %s", method, route)
 	return nil
 }
 
+var (
+	serverRequestsInFlight = metrics.NewGauge(
+		"http_server_requests_in_flight",
+		"Number of http requests currently being served.",
+	)
+	serverRequestDuration = metrics.NewHistogram(
+		"http_server_request_duration_seconds",
+		"Duration of http requests, labeled by chi route pattern.",
+		nil, "method", "route", "status",
+	)
+	serverResponseBytes = metrics.NewCounter(
+		"http_server_response_bytes_total",
+		"Number of bytes written in http response bodies.",
+		"method", "route", "status",
+	)
+)
+
+// metricMethod limits the method label to the well-known methods.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// metricRoute returns the matched chi route pattern, never the raw url.
+func metricRoute(request *http.Request) string {
+	if routeContext := chi.RouteContext(request.Context()); routeContext != nil {
+		if pattern := routeContext.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
+
+const headerRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns the id of the current request, either honored from the
+// X-Request-ID header or generated by the server.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// isValidRequestID only accepts short printable ids, so that a client cannot
+// inject arbitrary content into the logs.
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for index := range len(requestID) {
+		if c := requestID[index]; c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// metricStatus reports the implicit 200 of handlers that never wrote anything.
+func metricStatus(status int) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return strconv.Itoa(status)
+}
+
+// instrument sets the request id, starts the request span and records the
+// metrics. It is always the first middleware after the before middlewares, so
+// that it stays even when the logger is replaced.
+func (s *httpServer) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// honor the upstream request id and trace context
+		requestID := request.Header.Get(headerRequestID)
+		if !isValidRequestID(requestID) {
+			requestID = fmt.Sprintf("%016x", rand.Uint64())
+		}
+		writer.Header().Set(headerRequestID, requestID)
+		ctx := request.Context()
+		if remote, ok := tracing.Extract(request.Header); ok {
+			ctx = tracing.ContextWithRemote(ctx, remote)
+		}
+		ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+		ctx, span := tracing.Start(ctx, request.Method, tracing.SpanKindServer)
+		request = request.WithContext(ctx)
+		wrappedWriter := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
+		serverRequestsInFlight.With().Inc()
+		// the route is only known once the next handlers returned
+		defer func(start time.Time) {
+			serverRequestsInFlight.With().Dec()
+			route := metricRoute(request)
+			labels := []string{metricMethod(request.Method), route, metricStatus(wrappedWriter.Status())}
+			serverRequestDuration.With(labels...).Observe(time.Since(start).Seconds())
+			serverResponseBytes.With(labels...).Add(float64(wrappedWriter.BytesWritten()))
+			span.SetName(request.Method + " " + route)
+			span.SetAttribute("http.request.method", request.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("http.response.status_code", wrappedWriter.Status())
+			span.SetAttribute("url.path", request.URL.Path)
+			span.SetAttribute("request_id", requestID)
+			if wrappedWriter.Status() >= http.StatusInternalServerError {
+				span.SetStatus(tracing.StatusError, http.StatusText(wrappedWriter.Status()))
+			}
+			span.End()
+		}(time.Now())
+		// call the next handler
+		next.ServeHTTP(wrappedWriter, request)
+	})
+}
+
+// log puts the request logger in the context, and logs the request and the
+// response, or a single access event.
 func (s *httpServer) log(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		logger := s.logger.With().Str("request_id", fmt.Sprintf("%016x", rand.Uint64())).Logger()
-		// log request and response
-		logger.Info().
-			Str("method", request.Method).
-			Stringer("url", request.URL).
-			Msg("Request")
-		start := time.Now()
+		ctx := request.Context()
+		logger := s.logger.With().
+			Str("request_id", RequestID(ctx)).
+			EmbedObject(tracing.SpanFromContext(ctx).SpanContext()).
+			Logger()
+		var requestBody *countingReader
+		if s.access == nil {
+			logger.Info().
+				Str("method", request.Method).
+				Stringer("url", request.URL).
+				Msg("Request")
+		} else if request.Body != nil && request.Body != http.NoBody {
+			requestBody = &countingReader{ReadCloser: request.Body}
+			request.Body = requestBody
+		}
 		wrappedWriter := middleware.NewWrapResponseWriter(writer, request.ProtoMajor)
-		defer func(start time.Time, wrappedWriter middleware.WrapResponseWriter) {
+		defer func(start time.Time) {
 			duration := time.Since(start)
-			logger.Info().
-				Int("status", wrappedWriter.Status()).
-				Int("bytes", wrappedWriter.BytesWritten()).
-				Dur("duration", duration).
-				Msg("Response")
-		}(start, wrappedWriter)
-		// recover any panic
-		defer func() {
-			if recovered := exception.Recover(recover()); recovered != nil {
-				logger.Error().Err(recovered).Msg("Recovered from panic")
-				// response with 500 Internal Server Error
-				if request.Header.Get("Connection") != "Upgrade" {
-					wrappedWriter.WriteHeader(http.StatusInternalServerError)
-				}
+			if s.access == nil {
+				logger.Info().
+					Int("status", wrappedWriter.Status()).
+					Int("bytes", wrappedWriter.BytesWritten()).
+					Dur("duration", duration).
+					Msg("Response")
+				return
+			}
+			entry := accessEntry{
+				request:       request,
+				route:         metricRoute(request),
+				status:        wrappedWriter.Status(),
+				responseBytes: wrappedWriter.BytesWritten(),
+				start:         start,
+				duration:      duration,
+			}
+			if entry.status == 0 {
+				entry.status = http.StatusOK
+			}
+			if requestBody != nil {
+				entry.requestBytes = requestBody.count.Load()
 			}
-		}()
+			s.access.write(&logger, entry)
+		}(time.Now())
 		// call the next handler
-		next.ServeHTTP(wrappedWriter, request.WithContext(logger.WithContext(request.Context())))
+		next.ServeHTTP(wrappedWriter, request.WithContext(logger.WithContext(ctx)))
 	})
 }
+
+// requestLogger returns the logger of the request, or the server logger when
+// the logger middleware is disabled.
+func (s *httpServer) requestLogger(request *http.Request) *zerolog.Logger {
+	if logger := zerolog.Ctx(request.Context()); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return s.logger
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/thanhminhmr/go-common/session"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// WithSessions adds the middleware loading the session of the request into
+// its context, and saving it before the response is written. It runs before
+// the authentication, so that an authenticator can rely on the session. The
+// session is bound to a *session.Session field tagged with session.
+func WithSessions(manager *session.Manager) ServerOption {
+	return func(options *serverOptions) {
+		options.sessions = Sessions(manager)
+	}
+}
+
+// Sessions returns the middleware of WithSessions, for the routers not created
+// by NewServer.
+func Sessions(manager *session.Manager) Middleware {
+	if manager == nil {
+		panic("BUG: manager must not be nil")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			logger := zerolog.Ctx(request.Context())
+			loaded, err := manager.Load(request)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to load session")
+				response := ServerErrorResponse{
+					Status:    http.StatusInternalServerError,
+					Cause:     exception.String("Load session failed"),
+					RequestID: RequestID(request.Context()),
+				}
+				if err := response.Render(writer); err != nil {
+					logger.Error().Err(err).Msg("Failed to render error")
+				}
+				return
+			}
+			request = request.WithContext(session.ContextWithSession(request.Context(), loaded))
+			sessionWriter := &sessionWriter{
+				ResponseWriter: writer,
+				request:        request,
+				manager:        manager,
+				session:        loaded,
+			}
+			next.ServeHTTP(sessionWriter, request)
+			// a response without content
+			sessionWriter.save()
+		})
+	}
+}
+
+// sessionWriter saves the session when the response starts, since the cookie
+// is a header. A session failing to save replaces the response with an error.
+type sessionWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	manager *session.Manager
+	session *session.Session
+	saved   bool
+	failed  bool
+}
+
+// save saves the session once, returning false if it failed.
+func (w *sessionWriter) save() bool {
+	if w.saved {
+		return !w.failed
+	}
+	w.saved = true
+	if err := w.manager.Save(w.request.Context(), w.ResponseWriter, w.session); err != nil {
+		w.failed = true
+		logger := zerolog.Ctx(w.request.Context())
+		logger.Error().Err(err).Msg("Failed to save session")
+		resetHeader(w.ResponseWriter.Header())
+		response := ServerErrorResponse{
+			Status:    http.StatusInternalServerError,
+			Cause:     exception.String("Save session failed"),
+			RequestID: RequestID(w.request.Context()),
+		}
+		if err := response.Render(w.ResponseWriter); err != nil {
+			logger.Error().Err(err).Msg("Failed to render error")
+		}
+		return false
+	}
+	return true
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	// informational responses do not carry the cookie
+	if status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.save() {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	if !w.save() {
+		// discarded, the error is already answered
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) Flush() {
+	if w.save() {
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !w.save() {
+		return nil, nil, exception.String("Save session failed")
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func bindSession(request *http.Request, parsed any, fieldIndex int) *ServerErrorResponse {
+	loaded := session.SessionFromContext(request.Context())
+	if loaded == nil {
+		return &ServerErrorResponse{
+			Cause:  exception.String("Sessions are not enabled, see WithSessions"),
+			Status: http.StatusInternalServerError,
+		}
+	}
+	reflect.ValueOf(parsed).Elem().Field(fieldIndex).Set(reflect.ValueOf(loaded))
+	return nil
+}
+
+//region csrf
+
+// ErrInvalidCsrf is the cause of the 403 Forbidden responses of RequireCsrf.
+const ErrInvalidCsrf = exception.String("Invalid CSRF token")
+
+const (
+	// CsrfHeader is the header of the CSRF token checked by RequireCsrf.
+	CsrfHeader = "X-Csrf-Token"
+	// CsrfField is the form field of the CSRF token checked by RequireCsrf.
+	CsrfField = "csrf_token"
+)
+
+// csrfMaxFormSize limits the form read by RequireCsrf to find the token.
+const csrfMaxFormSize = 1 << 20
+
+// RequireCsrf answers 403 Forbidden to the unsafe requests without the CSRF
+// token of the session, given by session.Session.CsrfToken. The token is read
+// from the CsrfHeader, or from the CsrfField of a url-encoded form, the
+// multipart forms must use the header. It must run after the sessions.
+func RequireCsrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(writer, request)
+			return
+		}
+		loaded := session.SessionFromContext(request.Context())
+		if loaded == nil {
+			panic("BUG: RequireCsrf must run after the sessions, see WithSessions")
+		}
+		token := request.Header.Get(CsrfHeader)
+		if token == "" {
+			token = csrfFormToken(request)
+		}
+		if !loaded.VerifyCsrf(token) {
+			response := Forbidden(request, ErrInvalidCsrf)
+			if err := response.Render(writer); err != nil {
+				zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render error")
+			}
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// csrfFormToken returns the token of a url-encoded form, restoring the body
+// for the handler.
+func csrfFormToken(request *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || request.Body == nil {
+		return ""
+	}
+	original := request.Body
+	body, err := io.ReadAll(io.LimitReader(original, csrfMaxFormSize))
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{Reader: io.MultiReader(bytes.NewReader(body), original), Closer: original}
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return values.Get(CsrfField)
+}
+
+//endregion csrf
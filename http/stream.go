@@ -0,0 +1,320 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// ServerStopping returns a channel closed when the server starts shutting down,
+// or nil outside a request of the server. Long-lived responses watch it, since
+// the shutdown waits for them to finish.
+func ServerStopping(ctx context.Context) <-chan struct{} {
+	if server := serverFromContext(ctx); server != nil {
+		return server.stopping
+	}
+	return nil
+}
+
+//region ServerSSEResponse
+
+// SSEEvent is an event of a ServerSSEResponse. Data is written as is when it is
+// a string or a []byte, and encoded as json otherwise.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  any
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+	// Comment is ignored by the client, such as a heartbeat.
+	Comment string
+}
+
+// ServerSSEResponse streams the events of either Events or Channel as
+// Server-Sent Events. The stream ends when the events end, the client
+// disconnects or the server shuts down, the iterator should also watch the
+// context to end early. Render without the request only ends when a write
+// fails. A reconnecting client sends the id of its last event, to resume the
+// stream after it, bound by a request field such as:
+//
+//	LastEventID string `header:"Last-Event-ID"`
+type ServerSSEResponse struct {
+	Events  iter.Seq[SSEEvent]
+	Channel <-chan SSEEvent
+	// Retry is sent first to tell the client how long to wait before
+	// reconnecting, zero leaves the client default.
+	Retry time.Duration
+	// Heartbeat is the interval of comments keeping an idle connection open
+	// through proxies, zero disables them.
+	Heartbeat time.Duration
+}
+
+func (r ServerSSEResponse) Render(writer http.ResponseWriter) error {
+	return r.render(context.Background(), writer)
+}
+
+func (r ServerSSEResponse) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	return r.render(request.Context(), writer)
+}
+
+func (r ServerSSEResponse) render(ctx context.Context, writer http.ResponseWriter) error {
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	stream := newStream(ctx, writer)
+	if r.Retry > 0 {
+		if err := stream.write([]byte("retry: " + strconv.FormatInt(r.Retry.Milliseconds(), 10) + "\n\n")); err != nil {
+			return stream.failed(err)
+		}
+	}
+	var buffer bytes.Buffer
+	return runStream(stream, r.Heartbeat, newSource(r.Events, r.Channel), func(event SSEEvent) error {
+		buffer.Reset()
+		if err := event.encode(&buffer); err != nil {
+			return err
+		}
+		return stream.write(buffer.Bytes())
+	}, func() error {
+		return stream.write([]byte(":\n\n"))
+	})
+}
+
+func (e *SSEEvent) encode(buffer *bytes.Buffer) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return exception.String("Event id must not contain line breaks or null")
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return exception.String("Event name must not contain line breaks")
+	}
+	if e.Comment != "" {
+		writeSSEField(buffer, "", e.Comment)
+	}
+	if e.ID != "" {
+		writeSSEField(buffer, "id", e.ID)
+	}
+	if e.Event != "" {
+		writeSSEField(buffer, "event", e.Event)
+	}
+	if e.Retry > 0 {
+		writeSSEField(buffer, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	switch data := e.Data.(type) {
+	case nil:
+	case string:
+		writeSSEField(buffer, "data", data)
+	case []byte:
+		writeSSEField(buffer, "data", string(data))
+	default:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return exception.String("Encode event data failed").AddCause(err)
+		}
+		writeSSEField(buffer, "data", string(encoded))
+	}
+	buffer.WriteByte('\n')
+	return nil
+}
+
+// writeSSEField writes a field per line of the value, the client joins them
+// back with line feeds.
+func writeSSEField(buffer *bytes.Buffer, name string, value string) {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	for line := range strings.SplitSeq(value, "\n") {
+		for line := range strings.SplitSeq(line, "\r") {
+			buffer.WriteString(name)
+			buffer.WriteString(": ")
+			buffer.WriteString(line)
+			buffer.WriteByte('\n')
+		}
+	}
+}
+
+//endregion ServerSSEResponse
+
+//region ServerJsonStreamResponse
+
+// ServerJsonStreamResponse streams the values of either Values or Channel as
+// newline-delimited json, or as a json array, flushing every value. The stream
+// ends like a ServerSSEResponse.
+type ServerJsonStreamResponse[Value any] struct {
+	Status  int
+	Values  iter.Seq[Value]
+	Channel <-chan Value
+	// Array streams a json array in place of newline-delimited json.
+	Array bool
+}
+
+func (r ServerJsonStreamResponse[Value]) Render(writer http.ResponseWriter) error {
+	return r.render(context.Background(), writer)
+}
+
+func (r ServerJsonStreamResponse[Value]) RenderRequest(writer http.ResponseWriter, request *http.Request) error {
+	return r.render(request.Context(), writer)
+}
+
+func (r ServerJsonStreamResponse[Value]) render(ctx context.Context, writer http.ResponseWriter) error {
+	if r.Array {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		writer.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(r.Status)
+	stream := newStream(ctx, writer)
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	if r.Array {
+		buffer.WriteByte('[')
+	}
+	first := true
+	err := runStream(stream, 0, newSource(r.Values, r.Channel), func(value Value) error {
+		if r.Array && !first {
+			buffer.WriteByte(',')
+		}
+		first = false
+		if err := encoder.Encode(value); err != nil {
+			return exception.String("Encode value failed").AddCause(err)
+		}
+		if r.Array {
+			// drop the line feed of the encoder
+			buffer.Truncate(buffer.Len() - 1)
+		}
+		err := stream.write(buffer.Bytes())
+		buffer.Reset()
+		return err
+	}, nil)
+	if err != nil || !r.Array {
+		return err
+	}
+	// close the array even when stopped early, the client still gets valid json
+	buffer.WriteByte(']')
+	return stream.failed(stream.write(buffer.Bytes()))
+}
+
+//endregion ServerJsonStreamResponse
+
+//region stream
+
+type stream struct {
+	ctx        context.Context
+	writer     http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func newStream(ctx context.Context, writer http.ResponseWriter) *stream {
+	s := &stream{ctx: ctx, writer: writer, controller: http.NewResponseController(writer)}
+	// send the header now, the first value may take a while
+	_ = s.controller.Flush()
+	return s
+}
+
+func (s *stream) write(data []byte) error {
+	if _, err := s.writer.Write(data); err != nil {
+		return exception.String("Write stream failed").AddCause(err)
+	}
+	if err := s.controller.Flush(); err != nil {
+		return exception.String("Flush stream failed").AddCause(err)
+	}
+	return nil
+}
+
+// failed ignores the write errors of a client that is gone.
+func (s *stream) failed(err error) error {
+	if err != nil && s.ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// source feeds the values of either an iterator or a channel. The iterator runs
+// in its own goroutine, so that the stream can wait for the values, the client
+// and the server at once, and its panic is raised again in the handler.
+type source[Value any] struct {
+	values    <-chan Value
+	done      chan struct{}
+	recovered any
+}
+
+func newSource[Value any](values iter.Seq[Value], channel <-chan Value) *source[Value] {
+	if (values == nil) == (channel == nil) {
+		panic("BUG: exactly one of the iterator and the channel must be set")
+	}
+	if channel != nil {
+		return &source[Value]{values: channel}
+	}
+	pumped := make(chan Value)
+	s := &source[Value]{values: pumped, done: make(chan struct{})}
+	go func() {
+		defer close(pumped)
+		defer func() {
+			s.recovered = recover()
+		}()
+		for value := range values {
+			select {
+			case pumped <- value:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *source[Value]) stop() {
+	if s.done != nil {
+		close(s.done)
+	}
+}
+
+// runStream emits the values until they end, the client disconnects or the
+// server shuts down, with a heartbeat between them if enabled.
+func runStream[Value any](
+	s *stream,
+	heartbeat time.Duration,
+	source *source[Value],
+	emit func(value Value) error,
+	beat func() error,
+) error {
+	defer source.stop()
+	var ticks <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	stopping := ServerStopping(s.ctx)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-stopping:
+			return nil
+		case <-ticks:
+			if err := beat(); err != nil {
+				return s.failed(err)
+			}
+		case value, ok := <-source.values:
+			if !ok {
+				// the channel is closed after recovered is set
+				if source.recovered != nil {
+					panic(source.recovered)
+				}
+				return nil
+			}
+			if err := emit(value); err != nil {
+				return s.failed(err)
+			}
+		}
+	}
+}
+
+//endregion stream
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-common/metrics"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// WebSocketOptions configures the handshake and the connections of a
+// ServerWebSocket.
+type WebSocketOptions struct {
+	// Subprotocols are the supported subprotocols, in order of preference.
+	Subprotocols []string
+	// OriginPatterns are the host patterns of the allowed cross-origin
+	// handshakes, such as "*.example.com". Same-origin handshakes are always
+	// allowed.
+	OriginPatterns []string
+	// ReadLimit is the maximum size of a received message, zero keeps the
+	// default of 32 KiB.
+	ReadLimit int64
+	// PingInterval is the interval of the pings closing the dead connections,
+	// zero disables them. The pongs are only received while reading.
+	PingInterval time.Duration
+	// Compression enables the per-message deflate extension, for the messages
+	// larger than the CompressionThreshold.
+	Compression          bool
+	CompressionThreshold int
+}
+
+// WebSocket is an accepted WebSocket connection.
+type WebSocket struct {
+	*websocket.Conn
+}
+
+// ReadJson reads a message as json.
+func (s *WebSocket) ReadJson(ctx context.Context, value any) error {
+	return wsjson.Read(ctx, s.Conn, value)
+}
+
+// WriteJson writes a text message as json.
+func (s *WebSocket) WriteJson(ctx context.Context, value any) error {
+	return wsjson.Write(ctx, s.Conn, value)
+}
+
+// WebSocketHandler handles an accepted WebSocket connection, which is closed
+// when it returns. A nil error closes it normally, other errors close it with
+// an internal error.
+type WebSocketHandler[ServerRequest any] func(ctx context.Context, request *ServerRequest, socket *WebSocket) error
+
+// ServerWebSocket binds the handshake to ServerRequest like ServerRequestParser,
+// then upgrades the connection and calls the handler. The connections are
+// closed with a going away status when the server shuts down.
+func ServerWebSocket[ServerRequest any](options *WebSocketOptions, handler WebSocketHandler[ServerRequest]) http.HandlerFunc {
+	tags := checkServerRequestConfiguration[ServerRequest]()
+	if tags.flags&(tagForm|tagJson|tagMultipart|tagMultipartForm|tagBody|tagCodec) != 0 {
+		panic("BUG: WebSocket handshake has no body to bind")
+	}
+	if options == nil {
+		options = &WebSocketOptions{}
+	}
+	acceptOptions := &websocket.AcceptOptions{
+		Subprotocols:         options.Subprotocols,
+		OriginPatterns:       options.OriginPatterns,
+		CompressionMode:      websocket.CompressionDisabled,
+		CompressionThreshold: options.CompressionThreshold,
+	}
+	if options.Compression {
+		acceptOptions.CompressionMode = websocket.CompressionNoContextTakeover
+	}
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := zerolog.Ctx(request.Context())
+		var parsed ServerRequest
+		if errorResponse := parseServerRequest(request, &parsed, tags); errorResponse != nil {
+			logger.Error().Err(errorResponse).Msg("Failed to parse request")
+			if err := errorResponse.Render(writer); err != nil {
+				logger.Error().Err(err).Msg("Failed to render error")
+			}
+			return
+		}
+		// refuse new connections once the server is shutting down
+		server := serverFromContext(request.Context())
+		if server != nil && !server.sockets.acquire() {
+			response := ServerErrorResponse{
+				Status:    http.StatusServiceUnavailable,
+				Cause:     exception.String("Server is shutting down"),
+				RequestID: RequestID(request.Context()),
+			}
+			if err := response.Render(writer); err != nil {
+				logger.Error().Err(err).Msg("Failed to render error")
+			}
+			return
+		}
+		// the handshake errors are already answered
+		connection, err := websocket.Accept(writer, request, acceptOptions)
+		if err != nil {
+			if server != nil {
+				server.sockets.release()
+			}
+			logger.Warn().Err(err).Msg("WebSocket handshake failed")
+			return
+		}
+		if server != nil {
+			server.sockets.add(connection)
+			defer server.sockets.remove(connection)
+		}
+		if options.ReadLimit > 0 {
+			connection.SetReadLimit(options.ReadLimit)
+		}
+		ctx, cancel := context.WithCancel(request.Context())
+		defer cancel()
+		if options.PingInterval > 0 {
+			go pingWebSocket(ctx, connection, options.PingInterval)
+		}
+		serverWebSocketsOpen.With().Inc()
+		defer serverWebSocketsOpen.With().Dec()
+		logger.Debug().Str("subprotocol", connection.Subprotocol()).Msg("WebSocket opened")
+		err = handler(ctx, &parsed, &WebSocket{Conn: connection})
+		closeWebSocket(logger, connection, err)
+	}
+}
+
+func closeWebSocket(logger *zerolog.Logger, connection *websocket.Conn, err error) {
+	if err == nil {
+		_ = connection.Close(websocket.StatusNormalClosure, "")
+		logger.Debug().Msg("WebSocket closed")
+		return
+	}
+	// closed by the client, the server or a failed ping
+	if status := websocket.CloseStatus(err); status != -1 {
+		_ = connection.CloseNow()
+		logger.Debug().Int("status", int(status)).Msg("WebSocket closed")
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		_ = connection.CloseNow()
+		logger.Debug().Err(err).Msg("WebSocket closed")
+		return
+	}
+	logger.Error().Err(err).Msg("WebSocket handler failed")
+	_ = connection.Close(websocket.StatusInternalError, "Internal server error")
+}
+
+func pingWebSocket(ctx context.Context, connection *websocket.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := connection.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				zerolog.Ctx(ctx).Debug().Err(err).Msg("WebSocket ping failed")
+				_ = connection.Close(websocket.StatusPolicyViolation, "Ping timeout")
+			}
+			return
+		}
+	}
+}
+
+// webSockets tracks the open connections of a server, since the hijacked
+// connections are not awaited by the shutdown.
+type webSockets struct {
+	mutex   sync.Mutex
+	open    map[*websocket.Conn]struct{}
+	pending sync.WaitGroup
+	closing bool
+}
+
+// acquire reserves a connection, unless the server is shutting down.
+func (w *webSockets) acquire() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closing {
+		return false
+	}
+	w.pending.Add(1)
+	return true
+}
+
+func (w *webSockets) release() {
+	w.pending.Done()
+}
+
+func (w *webSockets) add(connection *websocket.Conn) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.open == nil {
+		w.open = map[*websocket.Conn]struct{}{}
+	}
+	w.open[connection] = struct{}{}
+}
+
+func (w *webSockets) remove(connection *websocket.Conn) {
+	w.mutex.Lock()
+	delete(w.open, connection)
+	w.mutex.Unlock()
+	w.release()
+}
+
+// closeAll sends a going away close frame to all the connections, then waits
+// for their handlers to return.
+func (w *webSockets) closeAll(ctx context.Context) error {
+	w.mutex.Lock()
+	w.closing = true
+	for connection := range w.open {
+		go func() {
+			_ = connection.Close(websocket.StatusGoingAway, "Server is shutting down")
+		}()
+	}
+	w.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		w.mutex.Lock()
+		for connection := range w.open {
+			_ = connection.CloseNow()
+		}
+		w.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+var serverWebSocketsOpen = metrics.NewGauge(
+	"http_server_websockets_open",
+	"Number of open WebSocket connections.",
+)
@@ -36,13 +36,16 @@ var SplitSemicolonsDecodeHookFunc = mapstructure.ComposeDecodeHookFunc(
 )
 
 func unboxIfElementSliceHasSingleElement(from reflect.Value, to reflect.Value) (any, error) {
-	// convert single value slice to value
+	// convert single value slice to value, unless the target takes the slice
+	// as is whatever its length
 	if from.Kind() == reflect.Slice && from.Len() == 1 {
 		toType := to.Type()
 		for toType.Kind() == reflect.Ptr {
 			toType = toType.Elem()
 		}
-		if toType.Kind() != reflect.Slice {
+		switch toType.Kind() {
+		case reflect.Slice, reflect.Array:
+		default:
 			return from.Index(0).Interface(), nil
 		}
 	}
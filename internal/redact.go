@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const RedactedValue = "[REDACTED]"
+
+var (
+	redactedHeadersMutex sync.RWMutex
+	redactedHeaders      = map[string]struct{}{}
+)
+
+func init() {
+	AddRedactedHeaders(
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+		"X-Auth-Token",
+		"X-Csrf-Token",
+	)
+}
+
+func AddRedactedHeaders(names ...string) {
+	redactedHeadersMutex.Lock()
+	defer redactedHeadersMutex.Unlock()
+	for _, name := range names {
+		redactedHeaders[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+}
+
+func IsRedactedHeader(name string) bool {
+	redactedHeadersMutex.RLock()
+	defer redactedHeadersMutex.RUnlock()
+	_, exists := redactedHeaders[http.CanonicalHeaderKey(name)]
+	return exists
+}
+
+// Redact converts the value to a tree of maps, slices and leaf values that
+// json can marshal, honoring the `log:"-"` and `log:"redact"` struct tags, the
+// header denylist for http.Header and header-tagged fields, and the sensitive
+// function for field names. Field names are taken from the nameTag tag.
+func Redact(value any, nameTag string, sensitive func(name string) bool) any {
+	redactor := redactor{nameTag: nameTag, sensitive: sensitive}
+	return redactor.walk(reflect.ValueOf(value), 0)
+}
+
+type redactor struct {
+	nameTag   string
+	sensitive func(name string) bool
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	headerType        = reflect.TypeFor[http.Header]()
+)
+
+const maxRedactDepth = 32
+
+func (r redactor) walk(value reflect.Value, depth int) any {
+	if !value.IsValid() {
+		return nil
+	}
+	if depth > maxRedactDepth {
+		return "[TOO DEEP]"
+	}
+	// the types that know how to marshal themselves are kept as is, unless a
+	// field is tagged to be hidden from the log
+	if (value.Type().Implements(jsonMarshalerType) || value.Type().Implements(textMarshalerType)) &&
+		!hasLogTags(value.Type()) {
+		if value.Kind() == reflect.Pointer && value.IsNil() {
+			return nil
+		}
+		return value.Interface()
+	}
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return r.walk(value.Elem(), depth+1)
+	case reflect.Struct:
+		return r.walkStruct(value, depth)
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		isHeader := value.Type() == headerType
+		output := make(map[string]any, value.Len())
+		iterator := value.MapRange()
+		for iterator.Next() {
+			key := toKey(iterator.Key())
+			if isHeader && IsRedactedHeader(key) {
+				output[key] = RedactedValue
+			} else {
+				output[key] = r.walk(iterator.Value(), depth+1)
+			}
+		}
+		return output
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		output := make([]any, value.Len())
+		for index := range value.Len() {
+			output[index] = r.walk(value.Index(index), depth+1)
+		}
+		return output
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return value.Type().String()
+	default:
+		return value.Interface()
+	}
+}
+
+func (r redactor) walkStruct(value reflect.Value, depth int) any {
+	valueType := value.Type()
+	output := make(map[string]any, valueType.NumField())
+	for index := range valueType.NumField() {
+		field := valueType.Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, exists := field.Tag.Lookup(r.nameTag); exists {
+			if tag == "-" {
+				continue
+			}
+			if tagName, _, _ := strings.Cut(tag, ","); tagName != "" {
+				name = tagName
+			}
+		}
+		switch tag := field.Tag.Get("log"); {
+		case tag == "-":
+			continue
+		case tag == "redact":
+			output[name] = RedactedValue
+			continue
+		}
+		if header, exists := field.Tag.Lookup("header"); exists && IsRedactedHeader(header) {
+			output[name] = RedactedValue
+			continue
+		}
+		// cookie values are as sensitive as the Cookie header they come from
+		if _, exists := field.Tag.Lookup("cookie"); exists && IsRedactedHeader("Cookie") {
+			output[name] = RedactedValue
+			continue
+		}
+		if r.sensitive != nil && r.sensitive(name) {
+			output[name] = RedactedValue
+			continue
+		}
+		// embedded structs without a name are flattened, as json does
+		fieldValue := r.walk(value.Field(index), depth+1)
+		if embedded, ok := fieldValue.(map[string]any); ok && field.Anonymous && name == field.Name {
+			for key, item := range embedded {
+				if _, exists := output[key]; !exists {
+					output[key] = item
+				}
+			}
+			continue
+		}
+		output[name] = fieldValue
+	}
+	return output
+}
+
+var logTagsCache sync.Map // map[reflect.Type]bool
+
+func hasLogTags(valueType reflect.Type) bool {
+	if cached, exists := logTagsCache.Load(valueType); exists {
+		return cached.(bool)
+	}
+	structType := valueType
+	for structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	found := false
+	if structType.Kind() == reflect.Struct {
+		for index := range structType.NumField() {
+			field := structType.Field(index)
+			if tag := field.Tag.Get("log"); field.IsExported() && (tag == "-" || tag == "redact") {
+				found = true
+				break
+			}
+		}
+	}
+	logTagsCache.Store(valueType, found)
+	return found
+}
+
+func toKey(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return value.String()
+	}
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		if text, err := marshaler.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(value.Interface())
+}
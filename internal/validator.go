@@ -1,5 +0,0 @@
-package internal
-
-import "github.com/go-playground/validator/v10"
-
-var Validator = validator.New(validator.WithRequiredStructEnabled())
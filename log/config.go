@@ -0,0 +1,180 @@
+package log
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+type LoggerConfig struct {
+	Format         string   `env:"LOG_FORMAT" validate:"oneof=auto console json logfmt"`
+	Level          string   `env:"LOG_LEVEL" validate:"oneof=trace debug info warn error fatal panic disabled"`
+	PackageLevels  []string `env:"LOG_PACKAGE_LEVELS"`
+	Caller         bool     `env:"LOG_CALLER"`
+	Outputs        []string `env:"LOG_OUTPUTS" validate:"min=1,dive,oneof=stderr stdout file"`
+	SampleLevel    string   `env:"LOG_SAMPLE_LEVEL" validate:"oneof=trace debug info warn error"`
+	SampleBurst    uint32   `env:"LOG_SAMPLE_BURST"`
+	SamplePeriod   uint32   `env:"LOG_SAMPLE_PERIOD" validate:"min=1,max=3600"`
+	SampleEvery    uint32   `env:"LOG_SAMPLE_EVERY"`
+	FilePath       string   `env:"LOG_FILE_PATH"`
+	FileMaxSize    uint32   `env:"LOG_FILE_MAX_SIZE"`
+	FileMaxAge     uint32   `env:"LOG_FILE_MAX_AGE"`
+	FileMaxBackups uint32   `env:"LOG_FILE_MAX_BACKUPS"`
+}
+
+func init() {
+	configuration.SetDefault("LOG_FORMAT", "auto")
+	configuration.SetDefault("LOG_LEVEL", "trace")
+	configuration.SetDefault("LOG_CALLER", "true")
+	configuration.SetDefault("LOG_OUTPUTS", "stderr")
+	configuration.SetDefault("LOG_SAMPLE_LEVEL", "debug")
+	configuration.SetDefault("LOG_SAMPLE_BURST", "0")
+	configuration.SetDefault("LOG_SAMPLE_PERIOD", "1")
+	configuration.SetDefault("LOG_SAMPLE_EVERY", "0")
+	configuration.SetDefault("LOG_FILE_PATH", "logs/app.log")
+	configuration.SetDefault("LOG_FILE_MAX_SIZE", "100")
+	configuration.SetDefault("LOG_FILE_MAX_AGE", "7")
+	configuration.SetDefault("LOG_FILE_MAX_BACKUPS", "10")
+}
+
+// NewLogger creates the global context with a logger built from the config.
+// File sizes are in megabytes and file ages are in days. Events at or below the
+// sample level are sampled when a burst is set: the first burst events of every
+// period pass, then only one out of every sample-every events passes.
+func NewLogger(lifecycle fx.Lifecycle, config *LoggerConfig) (context.Context, error) {
+	// levels
+	global, err := zerolog.ParseLevel(config.Level)
+	if err != nil {
+		return nil, exception.String("Invalid log level").AddCause(err)
+	}
+	packages, err := parsePackageLevels(config.PackageLevels)
+	if err != nil {
+		return nil, err
+	}
+	levels.mutex.Lock()
+	levels.global.Store(int32(global))
+	levels.apply(packages)
+	levels.mutex.Unlock()
+	// outputs
+	var writers []io.Writer
+	var closers []io.Closer
+	for _, output := range config.Outputs {
+		switch output {
+		case "stderr":
+			writers = append(writers, formatWriter(config.Format, os.Stderr))
+		case "stdout":
+			writers = append(writers, formatWriter(config.Format, os.Stdout))
+		case "file":
+			file, err := openRotatingFile(
+				config.FilePath,
+				int64(config.FileMaxSize)<<20,
+				time.Duration(config.FileMaxAge)*24*time.Hour,
+				int(config.FileMaxBackups),
+			)
+			if err != nil {
+				return nil, err
+			}
+			writers = append(writers, formatWriter(config.Format, file))
+			closers = append(closers, file)
+		}
+	}
+	// create the logger
+	builder := zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp()
+	if config.Caller {
+		builder = builder.Caller()
+	}
+	logger := builder.Logger().Hook(levels)
+	if config.SampleBurst > 0 {
+		sampleLevel, err := zerolog.ParseLevel(config.SampleLevel)
+		if err != nil {
+			return nil, exception.String("Invalid sample level").AddCause(err)
+		}
+		logger = logger.Sample(newLevelSampler(sampleLevel, config))
+	}
+	return withLifecycle(lifecycle, logger, closers...), nil
+}
+
+func withLifecycle(lifecycle fx.Lifecycle, logger zerolog.Logger, closers ...io.Closer) context.Context {
+	// create the global context with lifecycle cancel binding and the logger
+	ctx, cancel := context.WithCancel(logger.WithContext(context.Background()))
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			cancel()
+			for _, closer := range closers {
+				if err := closer.Close(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	return ctx
+}
+
+// formatWriter wraps the output to produce the format, "auto" being console on
+// a terminal and json anywhere else.
+func formatWriter(format string, output io.Writer) io.Writer {
+	terminal := isTerminal(output)
+	if format == "auto" {
+		format = "json"
+		if terminal {
+			format = "console"
+		}
+	}
+	switch format {
+	case "console":
+		return zerolog.ConsoleWriter{
+			Out:        output,
+			NoColor:    !terminal,
+			TimeFormat: timeFormat,
+		}
+	case "logfmt":
+		return newLogfmtWriter(output)
+	default:
+		return output
+	}
+}
+
+func isTerminal(output io.Writer) bool {
+	file, ok := output.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newLevelSampler(level zerolog.Level, config *LoggerConfig) zerolog.Sampler {
+	var next zerolog.Sampler
+	if config.SampleEvery > 0 {
+		next = &zerolog.BasicSampler{N: config.SampleEvery}
+	}
+	sampler := &zerolog.BurstSampler{
+		Burst:       config.SampleBurst,
+		Period:      time.Duration(config.SamplePeriod) * time.Second,
+		NextSampler: next,
+	}
+	levelSampler := &zerolog.LevelSampler{}
+	for _, target := range []struct {
+		level   zerolog.Level
+		sampler *zerolog.Sampler
+	}{
+		{zerolog.TraceLevel, &levelSampler.TraceSampler},
+		{zerolog.DebugLevel, &levelSampler.DebugSampler},
+		{zerolog.InfoLevel, &levelSampler.InfoSampler},
+		{zerolog.WarnLevel, &levelSampler.WarnSampler},
+		{zerolog.ErrorLevel, &levelSampler.ErrorSampler},
+	} {
+		if target.level <= level {
+			*target.sampler = sampler
+		}
+	}
+	return levelSampler
+}
@@ -0,0 +1,315 @@
+package log
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+//region overrides
+
+// override remembers what a temporary level replaced, so that it can be
+// restored once the override expires.
+type override struct {
+	previous zerolog.Level
+	existed  bool
+	expiry   time.Time
+	timer    *time.Timer
+}
+
+var (
+	overridesMutex sync.Mutex
+	overrides      = map[string]*override{} // "" is the global level
+)
+
+// SetLevel changes the global level. A positive ttl makes the change temporary,
+// the level then reverts to the one in place before the first temporary change.
+func SetLevel(level zerolog.Level, ttl time.Duration) {
+	setOverride("", level, ttl)
+}
+
+// SetPackageLevel changes the level of a package, see SetLevel.
+func SetPackageLevel(name string, level zerolog.Level, ttl time.Duration) {
+	if name == "" {
+		panic("BUG: package name must not be empty")
+	}
+	setOverride(name, level, ttl)
+}
+
+// ResetLevel reverts a temporary global level immediately.
+func ResetLevel() {
+	revertOverride("")
+}
+
+// ResetPackageLevel reverts a temporary package level immediately, or removes
+// the package level if it is not temporary.
+func ResetPackageLevel(name string) {
+	overridesMutex.Lock()
+	_, temporary := overrides[name]
+	overridesMutex.Unlock()
+	if temporary {
+		revertOverride(name)
+	} else {
+		levels.ResetPackage(name)
+	}
+}
+
+func currentLevel(name string) (zerolog.Level, bool) {
+	if name == "" {
+		return levels.Global(), true
+	}
+	level, exists := (*levels.packages.Load())[name]
+	return level, exists
+}
+
+func applyLevel(name string, level zerolog.Level, exists bool) {
+	switch {
+	case name == "":
+		levels.SetGlobal(level)
+	case exists:
+		levels.SetPackage(name, level)
+	default:
+		levels.ResetPackage(name)
+	}
+}
+
+func setOverride(name string, level zerolog.Level, ttl time.Duration) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	found, temporary := overrides[name]
+	if temporary {
+		found.timer.Stop()
+	}
+	if ttl <= 0 {
+		delete(overrides, name)
+	} else {
+		if !temporary {
+			previous, existed := currentLevel(name)
+			found = &override{previous: previous, existed: existed}
+			overrides[name] = found
+		}
+		expiry := time.Now().Add(ttl)
+		found.expiry = expiry
+		found.timer = time.AfterFunc(ttl, func() {
+			expireOverride(name, expiry)
+		})
+	}
+	applyLevel(name, level, true)
+}
+
+func revertOverride(name string) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	if found, temporary := overrides[name]; temporary {
+		found.timer.Stop()
+		delete(overrides, name)
+		applyLevel(name, found.previous, found.existed)
+	}
+}
+
+// expireOverride reverts the override only if it was not extended meanwhile.
+func expireOverride(name string, expiry time.Time) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	if found, temporary := overrides[name]; temporary && found.expiry.Equal(expiry) {
+		delete(overrides, name)
+		applyLevel(name, found.previous, found.existed)
+	}
+}
+
+//endregion overrides
+
+//region LevelControl
+
+// LevelControlConfig configures the level endpoint and the signals. The
+// endpoint requires the token as a bearer token when it is set.
+type LevelControlConfig struct {
+	Path        string `env:"LOG_LEVEL_PATH" validate:"required,startswith=/"`
+	Token       string `env:"LOG_LEVEL_TOKEN" log:"redact"`
+	SignalLevel string `env:"LOG_LEVEL_SIGNAL_LEVEL" validate:"oneof=trace debug info warn error"`
+	DefaultTTL  uint32 `env:"LOG_LEVEL_DEFAULT_TTL" validate:"min=0,max=86400"`
+}
+
+func init() {
+	configuration.SetDefault("LOG_LEVEL_PATH", "/debug/log/level")
+	configuration.SetDefault("LOG_LEVEL_SIGNAL_LEVEL", "trace")
+	configuration.SetDefault("LOG_LEVEL_DEFAULT_TTL", "600")
+}
+
+type LevelControlParams struct {
+	fx.In
+	Context   context.Context
+	Lifecycle fx.Lifecycle
+	Config    *LevelControlConfig
+	Router    chi.Router `optional:"true"`
+	// AdminRouter is a router only reachable by operators, such as one served
+	// on a private port, named "admin".
+	AdminRouter chi.Router `name:"admin" optional:"true"`
+}
+
+// NewLevelControl mounts the level endpoint, and listens to SIGUSR1 to
+// temporary switch the global level to the signal level, and to SIGUSR2 to
+// revert it. The endpoint is mounted on the admin router when there is one,
+// otherwise on the router only when a token is configured, it is not mounted
+// at all when neither is available.
+func NewLevelControl(params LevelControlParams) error {
+	signalLevel, err := zerolog.ParseLevel(params.Config.SignalLevel)
+	if err != nil {
+		return exception.String("Invalid signal level").AddCause(err)
+	}
+	control := &levelControl{
+		ctx:         params.Context,
+		signalLevel: signalLevel,
+		defaultTTL:  time.Duration(params.Config.DefaultTTL) * time.Second,
+	}
+	router := params.AdminRouter
+	if router == nil && params.Config.Token != "" {
+		router = params.Router
+	}
+	if router != nil {
+		router.Group(func(router chi.Router) {
+			if params.Config.Token != "" {
+				router.Use(requireToken(params.Config.Token))
+			}
+			router.Get(params.Config.Path, control.get)
+			router.Put(params.Config.Path, control.put)
+			router.Delete(params.Config.Path, control.delete)
+		})
+	} else if params.Router != nil {
+		zerolog.Ctx(params.Context).Warn().Msg("Log level endpoint is disabled, set LOG_LEVEL_TOKEN or provide an admin router")
+	}
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: control.onStart,
+		OnStop:  control.onStop,
+	})
+	return nil
+}
+
+// requireToken answers 401 Unauthorized to the requests without the bearer
+// token.
+func requireToken(token string) func(http.Handler) http.Handler {
+	expected := sha256.Sum256([]byte(token))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			given, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+			// hashed, so that the comparison does not leak the length
+			actual := sha256.Sum256([]byte(given))
+			if !found || subtle.ConstantTimeCompare(actual[:], expected[:]) != 1 {
+				writer.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+type levelControl struct {
+	ctx         context.Context
+	signalLevel zerolog.Level
+	defaultTTL  time.Duration
+	stop        func()
+}
+
+func (c *levelControl) onStart(context.Context) error {
+	c.stop = listenLevelSignals(c.ctx, c.signalLevel, c.defaultTTL)
+	return nil
+}
+
+func (c *levelControl) onStop(context.Context) error {
+	if c.stop != nil {
+		c.stop()
+	}
+	return nil
+}
+
+type levelState struct {
+	Level     string            `json:"level"`
+	Packages  map[string]string `json:"packages"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+type levelChange struct {
+	Level   string `json:"level"`
+	Package string `json:"package"`
+	TTL     string `json:"ttl"`
+}
+
+func (c *levelControl) get(writer http.ResponseWriter, request *http.Request) {
+	state := levelState{
+		Level:     levels.Global().String(),
+		Packages:  map[string]string{},
+		Overrides: map[string]string{},
+	}
+	for name, level := range levels.Packages() {
+		state.Packages[name] = level.String()
+	}
+	overridesMutex.Lock()
+	for name, found := range overrides {
+		state.Overrides[name] = found.expiry.Format(time.RFC3339)
+	}
+	overridesMutex.Unlock()
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(writer).Encode(state); err != nil {
+		zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to render log levels")
+	}
+}
+
+// put changes a level, the ttl is a Go duration where "0" means permanent and
+// an empty value means the default ttl.
+func (c *levelControl) put(writer http.ResponseWriter, request *http.Request) {
+	var change levelChange
+	if err := json.NewDecoder(request.Body).Decode(&change); err != nil {
+		http.Error(writer, "Decode json body failed", http.StatusBadRequest)
+		return
+	}
+	level, err := zerolog.ParseLevel(change.Level)
+	if err != nil || change.Level == "" {
+		http.Error(writer, "Level is invalid", http.StatusBadRequest)
+		return
+	}
+	ttl := c.defaultTTL
+	if change.TTL != "" {
+		if ttl, err = time.ParseDuration(change.TTL); err != nil || ttl < 0 {
+			http.Error(writer, "TTL is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+	zerolog.Ctx(c.ctx).Warn().
+		Str("package", change.Package).
+		Stringer("level", level).
+		Dur("ttl", ttl).
+		Msg("Changing log level")
+	if change.Package == "" {
+		SetLevel(level, ttl)
+	} else {
+		SetPackageLevel(change.Package, level, ttl)
+	}
+	c.get(writer, request)
+}
+
+func (c *levelControl) delete(writer http.ResponseWriter, request *http.Request) {
+	name := request.URL.Query().Get("package")
+	zerolog.Ctx(c.ctx).Warn().Str("package", name).Msg("Resetting log level")
+	if name == "" {
+		ResetLevel()
+	} else {
+		ResetPackageLevel(name)
+	}
+	c.get(writer, request)
+}
+
+//endregion LevelControl
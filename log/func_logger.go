@@ -16,7 +16,7 @@ func FuncOrAny(e *zerolog.Event, k string, v any) *zerolog.Event {
 	if r.Kind() == reflect.Func {
 		return e.Stringer(k, _func{v: r.Interface()})
 	}
-	return e.Any(k, v)
+	return e.Any(k, Redact(v))
 }
 
 func Func(v any) fmt.Stringer {
@@ -3,6 +3,8 @@ package log
 import (
 	"context"
 
+	"github.com/thanhminhmr/go-common/metrics"
+
 	"github.com/rs/zerolog"
 	"go.uber.org/dig"
 	"go.uber.org/fx/fxevent"
@@ -18,6 +20,20 @@ func InitFxLogger(ctx context.Context) fxevent.Logger {
 	return fxLogger{Logger: zerolog.Ctx(ctx)}
 }
 
+var fxHookDuration = metrics.NewHistogram(
+	"fx_hook_duration_seconds",
+	"Duration of fx lifecycle hooks.",
+	nil, "hook", "callee", "result",
+)
+
+func observeHook(hook string, callee string, err error, runtime float64) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	fxHookDuration.With(hook, callee, result).Observe(runtime)
+}
+
 type moduleName string
 
 func (m moduleName) MarshalZerologObject(event *zerolog.Event) {
@@ -35,6 +51,7 @@ func (l fxLogger) LogEvent(event fxevent.Event) {
 			Str("caller", e.CallerName).
 			Msg("OnStart hook executing")
 	case *fxevent.OnStartExecuted:
+		observeHook("OnStart", e.FunctionName, e.Err, e.Runtime.Seconds())
 		if e.Err != nil {
 			l.Error().
 				Str("callee", e.FunctionName).
@@ -54,6 +71,7 @@ func (l fxLogger) LogEvent(event fxevent.Event) {
 			Str("caller", e.CallerName).
 			Msg("OnStop hook executing")
 	case *fxevent.OnStopExecuted:
+		observeHook("OnStop", e.FunctionName, e.Err, e.Runtime.Seconds())
 		if e.Err != nil {
 			l.Error().
 				Str("callee", e.FunctionName).
@@ -0,0 +1,160 @@
+package log
+
+import (
+	"maps"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// levels is the level filter shared by every logger created by NewLogger.
+var levels = &levelFilter{}
+
+func init() {
+	levels.global.Store(int32(zerolog.TraceLevel))
+	levels.packages.Store(&map[string]zerolog.Level{})
+}
+
+// levelFilter holds the global level and per-package overrides. The zerolog
+// global level is kept at the lowest configured level so that disabled events
+// are still cheap, the filter then discards events from packages whose own
+// level is higher.
+type levelFilter struct {
+	mutex    sync.Mutex
+	global   atomic.Int32
+	packages atomic.Pointer[map[string]zerolog.Level]
+	// highest is the highest of the global and package levels, the events at
+	// or above it pass whatever their package
+	highest atomic.Int32
+	callers sync.Map // program counter -> package path
+}
+
+func (f *levelFilter) Global() zerolog.Level {
+	return zerolog.Level(f.global.Load())
+}
+
+func (f *levelFilter) Packages() map[string]zerolog.Level {
+	return maps.Clone(*f.packages.Load())
+}
+
+func (f *levelFilter) SetGlobal(level zerolog.Level) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.global.Store(int32(level))
+	f.apply(*f.packages.Load())
+}
+
+// SetPackage overrides the level of a package, matched by its full import path
+// or by its last path elements such as "http" or "go-common/http".
+func (f *levelFilter) SetPackage(name string, level zerolog.Level) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	packages := maps.Clone(*f.packages.Load())
+	packages[name] = level
+	f.apply(packages)
+}
+
+func (f *levelFilter) ResetPackage(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	packages := maps.Clone(*f.packages.Load())
+	delete(packages, name)
+	f.apply(packages)
+}
+
+func (f *levelFilter) apply(packages map[string]zerolog.Level) {
+	lowest, highest := f.Global(), f.Global()
+	for _, level := range packages {
+		lowest, highest = min(lowest, level), max(highest, level)
+	}
+	f.highest.Store(int32(highest))
+	f.packages.Store(&packages)
+	zerolog.SetGlobalLevel(lowest)
+}
+
+// Run implements zerolog.Hook.
+func (f *levelFilter) Run(event *zerolog.Event, level zerolog.Level, _ string) {
+	packages := *f.packages.Load()
+	threshold := f.Global()
+	// the caller is only looked up when a package level can change the outcome
+	if len(packages) > 0 && level != zerolog.NoLevel && level < zerolog.Level(f.highest.Load()) {
+		if override, exists := f.lookup(packages, f.caller()); exists {
+			threshold = override
+		}
+	}
+	if level < threshold && level != zerolog.NoLevel {
+		event.Discard()
+	}
+}
+
+func (f *levelFilter) lookup(packages map[string]zerolog.Level, path string) (zerolog.Level, bool) {
+	// the most specific match wins
+	for current := path; current != ""; {
+		if level, exists := packages[current]; exists {
+			return level, true
+		}
+		_, rest, found := strings.Cut(current, "/")
+		if !found {
+			break
+		}
+		current = rest
+	}
+	return zerolog.NoLevel, false
+}
+
+// caller returns the package path of the first frame outside zerolog and this
+// package.
+func (f *levelFilter) caller() string {
+	var pcs [16]uintptr
+	count := runtime.Callers(3, pcs[:])
+	for _, pc := range pcs[:count] {
+		if cached, exists := f.callers.Load(pc); exists {
+			if path := cached.(string); path != "" {
+				return path
+			}
+			continue
+		}
+		function := runtime.FuncForPC(pc)
+		if function == nil {
+			continue
+		}
+		path := packagePath(function.Name())
+		if path == "github.com/rs/zerolog" || path == "github.com/thanhminhmr/go-common/log" {
+			path = ""
+		}
+		f.callers.Store(pc, path)
+		if path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+func packagePath(function string) string {
+	slash := strings.LastIndexByte(function, '/') + 1
+	if dot := strings.IndexByte(function[slash:], '.'); dot >= 0 {
+		return function[:slash+dot]
+	}
+	return function
+}
+
+// parsePackageLevels parses "package=level" entries.
+func parsePackageLevels(entries []string) (map[string]zerolog.Level, error) {
+	packages := map[string]zerolog.Level{}
+	for _, entry := range entries {
+		name, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, exception.String("Invalid package level, expecting package=level: " + entry)
+		}
+		level, err := zerolog.ParseLevel(strings.TrimSpace(value))
+		if err != nil {
+			return nil, exception.String("Invalid package level: " + entry).AddCause(err)
+		}
+		packages[strings.TrimSpace(name)] = level
+	}
+	return packages, nil
+}
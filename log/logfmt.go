@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// logfmtWriter converts the JSON events produced by zerolog to logfmt lines,
+// keeping the original field order. Nested values are kept as compact JSON.
+type logfmtWriter struct {
+	mutex  sync.Mutex
+	output io.Writer
+	buffer bytes.Buffer
+}
+
+func newLogfmtWriter(output io.Writer) *logfmtWriter {
+	return &logfmtWriter{output: output}
+}
+
+func (w *logfmtWriter) Write(event []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buffer.Reset()
+	decoder := json.NewDecoder(bytes.NewReader(event))
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return 0, exception.String("Event is not a JSON object").AddCause(err)
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, exception.String("Decode event failed").AddCause(err)
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return 0, exception.String("Decode event failed").AddCause(err)
+		}
+		if w.buffer.Len() > 0 {
+			w.buffer.WriteByte(' ')
+		}
+		w.buffer.WriteString(logfmtKey(token.(string)))
+		w.buffer.WriteByte('=')
+		w.buffer.WriteString(logfmtValue(value))
+	}
+	w.buffer.WriteByte('\n')
+	if _, err := w.output.Write(w.buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(event), nil
+}
+
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func logfmtValue(raw json.RawMessage) string {
+	var text string
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			text = string(raw)
+		}
+	} else {
+		text = string(raw)
+	}
+	if text == "" || strings.ContainsAny(text, " =\"\\\t\r\n") {
+		return strconv.Quote(text)
+	}
+	return text
+}
@@ -0,0 +1,28 @@
+package log
+
+import (
+	"encoding/json"
+
+	"github.com/thanhminhmr/go-common/internal"
+)
+
+// Redact wraps a value so that, when logged, fields tagged `log:"-"` are
+// omitted, fields tagged `log:"redact"` are replaced, and denylisted headers,
+// either in an http.Header or in a header-tagged field, are replaced. The value
+// is only walked if the event is actually written.
+func Redact(value any) json.Marshaler {
+	return redacted{value: value}
+}
+
+// RedactHeaders adds headers to the denylist used by Redact.
+func RedactHeaders(names ...string) {
+	internal.AddRedactedHeaders(names...)
+}
+
+type redacted struct {
+	value any
+}
+
+func (r redacted) MarshalJSON() ([]byte, error) {
+	return json.Marshal(internal.Redact(r.value, "json", nil))
+}
@@ -0,0 +1,137 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+const rotateTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile is a file writer that rotates the file once it grows over a size
+// limit, then removes backups that are too old or too many.
+type rotatingFile struct {
+	mutex      sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	// file is nil after a failed reopen, retried by the next write
+	file *os.File
+	size int64
+	// closed is true once closed by the lifecycle
+	closed bool
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, exception.String("Create log directory failed").AddCause(err)
+	}
+	file := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return exception.String("Open log file failed").AddCause(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return exception.String("Stat log file failed").AddCause(err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(data []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// the logger outlives the lifecycle closing the file, its last events are
+	// dropped
+	if f.closed {
+		return len(data), nil
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	written, err := f.file.Write(data)
+	f.size += int64(written)
+	return written, err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return exception.String("Close log file failed").AddCause(err)
+	}
+	f.file = nil
+	extension := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, extension) + "-" + time.Now().Format(rotateTimeFormat) + extension
+	if err := os.Rename(f.path, backup); err != nil {
+		// keep writing to the current file
+		return exception.String("Rename log file failed").AddCause(err).AddSuppressed(f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.cleanup()
+	return nil
+}
+
+// cleanup removes backups, relying on the timestamp in their names to sort
+// them from the oldest to the newest.
+func (f *rotatingFile) cleanup() {
+	extension := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(f.path, extension) + "-"
+	backups, err := filepath.Glob(prefix + "*" + extension)
+	if err != nil {
+		return
+	}
+	slices.Sort(backups)
+	now := time.Now()
+	for index, backup := range backups {
+		timestamp, err := time.ParseInLocation(rotateTimeFormat, strings.TrimSuffix(strings.TrimPrefix(backup, prefix), extension), time.Local)
+		if err != nil {
+			continue
+		}
+		tooMany := f.maxBackups > 0 && len(backups)-index > f.maxBackups
+		tooOld := f.maxAge > 0 && now.Sub(timestamp) > f.maxAge
+		if tooMany || tooOld {
+			_ = os.Remove(backup)
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
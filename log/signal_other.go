@@ -0,0 +1,15 @@
+//go:build !unix
+
+package log
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// listenLevelSignals does nothing, SIGUSR1 and SIGUSR2 only exist on unix.
+func listenLevelSignals(context.Context, zerolog.Level, time.Duration) func() {
+	return func() {}
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package log
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func listenLevelSignals(ctx context.Context, level zerolog.Level, ttl time.Duration) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		logger := zerolog.Ctx(ctx)
+		for {
+			select {
+			case <-done:
+				return
+			case received := <-signals:
+				switch received {
+				case syscall.SIGUSR1:
+					logger.Warn().Stringer("level", level).Dur("ttl", ttl).Msg("Changing log level on signal")
+					SetLevel(level, ttl)
+				case syscall.SIGUSR2:
+					logger.Warn().Msg("Resetting log level on signal")
+					ResetLevel()
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
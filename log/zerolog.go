@@ -19,14 +19,6 @@ func ConsoleLogger(lifecycle fx.Lifecycle) context.Context {
 	logger := zerolog.New(zerolog.ConsoleWriter{
 		Out:        os.Stderr,
 		TimeFormat: timeFormat,
-	}).With().Timestamp().Caller().Logger()
-	// create the global context with lifecycle cancel binding and the logger
-	ctx, cancel := context.WithCancel(logger.WithContext(context.Background()))
-	lifecycle.Append(fx.Hook{
-		OnStop: func(context.Context) error {
-			cancel()
-			return nil
-		},
-	})
-	return ctx
+	}).With().Timestamp().Caller().Logger().Hook(levels)
+	return withLifecycle(lifecycle, logger)
 }
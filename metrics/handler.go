@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type Config struct {
+	Path string `env:"METRICS_PATH" validate:"required,startswith=/"`
+}
+
+func init() {
+	configuration.SetDefault("METRICS_PATH", "/metrics")
+}
+
+type Params struct {
+	fx.In
+	Config *Config
+	Router chi.Router
+}
+
+// Register mounts the default registry on the router.
+func Register(params Params) {
+	params.Router.Get(params.Config.Path, Handler(DefaultRegistry).ServeHTTP)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler(registry *Registry) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writer.WriteHeader(http.StatusOK)
+		if _, err := registry.WriteTo(writer); err != nil {
+			zerolog.Ctx(request.Context()).Error().Err(err).Msg("Failed to write metrics")
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the histogram buckets used when none are given, suitable
+// for durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// family holds every child of a metric, keyed by its label values.
+type family[T any] struct {
+	name     string
+	help     string
+	kind     metricType
+	labels   []string
+	create   func() *T
+	mutex    sync.RWMutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	values []string
+	value  *T
+}
+
+func newFamily[T any](name string, help string, kind metricType, labels []string, create func() *T) *family[T] {
+	return &family[T]{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		create:   create,
+		children: map[string]*child[T]{},
+	}
+}
+
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic("BUG: metric " + f.name + " expects " + strings.Join(f.labels, ",") + " labels")
+	}
+	key := strings.Join(values, "\xff")
+	f.mutex.RLock()
+	found, exists := f.children[key]
+	f.mutex.RUnlock()
+	if exists {
+		return found.value
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if found, exists := f.children[key]; exists {
+		return found.value
+	}
+	created := &child[T]{values: slices.Clone(values), value: f.create()}
+	f.children[key] = created
+	return created.value
+}
+
+func (f *family[T]) snapshot() []*child[T] {
+	f.mutex.RLock()
+	children := make([]*child[T], 0, len(f.children))
+	for _, found := range f.children {
+		children = append(children, found)
+	}
+	f.mutex.RUnlock()
+	slices.SortFunc(children, func(a, b *child[T]) int {
+		return slices.Compare(a.values, b.values)
+	})
+	return children
+}
+
+//region float
+
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat) Store(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+//endregion float
+
+//region Counter
+
+type Counter struct {
+	*family[CounterValue]
+}
+
+type CounterValue struct {
+	value atomicFloat
+}
+
+// NewCounter creates a counter and registers it to the default registry.
+func NewCounter(name string, help string, labels ...string) Counter {
+	counter := Counter{newFamily(name, help, typeCounter, labels, func() *CounterValue {
+		return &CounterValue{}
+	})}
+	DefaultRegistry.MustRegister(counter)
+	return counter
+}
+
+func (c Counter) With(values ...string) *CounterValue {
+	return c.with(values)
+}
+
+func (c Counter) collect(writer *exposition) {
+	for _, found := range c.snapshot() {
+		writer.sample(c.name, c.labels, found.values, "", "", found.value.value.Load())
+	}
+}
+
+func (v *CounterValue) Inc() {
+	v.value.Add(1)
+}
+
+func (v *CounterValue) Add(delta float64) {
+	if delta < 0 {
+		panic("BUG: counter cannot decrease")
+	}
+	v.value.Add(delta)
+}
+
+//endregion Counter
+
+//region Gauge
+
+type Gauge struct {
+	*family[GaugeValue]
+}
+
+type GaugeValue struct {
+	value atomicFloat
+}
+
+// NewGauge creates a gauge and registers it to the default registry.
+func NewGauge(name string, help string, labels ...string) Gauge {
+	gauge := Gauge{newFamily(name, help, typeGauge, labels, func() *GaugeValue {
+		return &GaugeValue{}
+	})}
+	DefaultRegistry.MustRegister(gauge)
+	return gauge
+}
+
+func (g Gauge) With(values ...string) *GaugeValue {
+	return g.with(values)
+}
+
+func (g Gauge) collect(writer *exposition) {
+	for _, found := range g.snapshot() {
+		writer.sample(g.name, g.labels, found.values, "", "", found.value.value.Load())
+	}
+}
+
+func (v *GaugeValue) Set(value float64) {
+	v.value.Store(value)
+}
+
+func (v *GaugeValue) Add(delta float64) {
+	v.value.Add(delta)
+}
+
+func (v *GaugeValue) Inc() {
+	v.value.Add(1)
+}
+
+func (v *GaugeValue) Dec() {
+	v.value.Add(-1)
+}
+
+//endregion Gauge
+
+//region Histogram
+
+type Histogram struct {
+	*family[HistogramValue]
+	buckets []float64
+}
+
+type HistogramValue struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomicFloat
+}
+
+// NewHistogram creates a histogram and registers it to the default registry. A
+// nil buckets means DefaultBuckets.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	histogram := Histogram{
+		family: newFamily(name, help, typeHistogram, labels, func() *HistogramValue {
+			return &HistogramValue{
+				buckets: buckets,
+				counts:  make([]atomic.Uint64, len(buckets)),
+			}
+		}),
+		buckets: buckets,
+	}
+	DefaultRegistry.MustRegister(histogram)
+	return histogram
+}
+
+func (h Histogram) With(values ...string) *HistogramValue {
+	return h.with(values)
+}
+
+func (h Histogram) collect(writer *exposition) {
+	for _, found := range h.snapshot() {
+		value := found.value
+		cumulative := uint64(0)
+		for index, bound := range value.buckets {
+			cumulative += value.counts[index].Load()
+			writer.sample(h.name+"_bucket", h.labels, found.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		count := value.count.Load()
+		writer.sample(h.name+"_bucket", h.labels, found.values, "le", "+Inf", float64(count))
+		writer.sample(h.name+"_sum", h.labels, found.values, "", "", value.sum.Load())
+		writer.sample(h.name+"_count", h.labels, found.values, "", "", float64(count))
+	}
+}
+
+func (v *HistogramValue) Observe(value float64) {
+	if index, _ := slices.BinarySearch(v.buckets, value); index < len(v.buckets) {
+		v.counts[index].Add(1)
+	}
+	v.sum.Add(value)
+	v.count.Add(1)
+}
+
+//endregion Histogram
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Collector interface {
+	collect(writer *exposition)
+	metadata() (name string, help string, kind metricType)
+}
+
+func (f *family[T]) metadata() (string, string, metricType) {
+	return f.name, f.help, f.kind
+}
+
+// Registry is a set of metrics exposed together in the Prometheus text format.
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]Collector
+}
+
+// DefaultRegistry is the registry used by the New* constructors and served by
+// Register.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]Collector{}}
+}
+
+func (r *Registry) MustRegister(collector Collector) {
+	name, _, _ := collector.metadata()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.collectors[name]; exists {
+		panic("BUG: metric " + name + " is already registered")
+	}
+	r.collectors[name] = collector
+}
+
+// WriteTo writes every registered metric in the Prometheus text format.
+func (r *Registry) WriteTo(writer io.Writer) (int64, error) {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+	output := exposition{writer: bufio.NewWriter(writer)}
+	for _, collector := range collectors {
+		name, help, kind := collector.metadata()
+		output.header(name, help, kind)
+		collector.collect(&output)
+	}
+	if err := output.writer.Flush(); err != nil {
+		return output.count, err
+	}
+	return output.count, output.err
+}
+
+type exposition struct {
+	writer *bufio.Writer
+	count  int64
+	err    error
+}
+
+func (e *exposition) write(value string) {
+	if e.err != nil {
+		return
+	}
+	written, err := e.writer.WriteString(value)
+	e.count += int64(written)
+	e.err = err
+}
+
+func (e *exposition) header(name string, help string, kind metricType) {
+	e.write("# HELP " + name + " " + helpReplacer.Replace(help) + "\n")
+	e.write("# TYPE " + name + " " + string(kind) + "\n")
+}
+
+func (e *exposition) sample(name string, labels []string, values []string, extraLabel string, extraValue string, value float64) {
+	e.write(name)
+	if len(labels) > 0 || extraLabel != "" {
+		e.write("{")
+		for index, label := range labels {
+			if index > 0 {
+				e.write(",")
+			}
+			e.write(label + `="` + labelReplacer.Replace(values[index]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				e.write(",")
+			}
+			e.write(extraLabel + `="` + extraValue + `"`)
+		}
+		e.write("}")
+	}
+	e.write(" " + formatFloat(value) + "\n")
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Requests per Period on average, with bursts of up to Burst
+// requests. A zero Burst means a burst as large as Requests. The zero Limit is
+// unlimited.
+type Limit struct {
+	Requests uint32
+	Period   time.Duration
+	Burst    uint32
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests == 0 || l.Period <= 0
+}
+
+func (l Limit) burst() uint32 {
+	if l.Burst == 0 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+// Result is the outcome of taking from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the burst.
+	Limit uint32
+	// Remaining is the number of requests that would be allowed right now.
+	Remaining uint32
+	// RetryAfter is the delay before the request would be allowed, zero when
+	// it is allowed.
+	RetryAfter time.Duration
+	// ResetAfter is the delay before the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Apply runs the generic cell rate algorithm on the theoretical arrival time
+// of a bucket, a zero time being a full bucket. It returns the new theoretical
+// arrival time to store, which is the same as the given one when the request
+// is denied. Stores use it to implement Take.
+func (l Limit) Apply(arrival time.Time, now time.Time, cost uint32) (time.Time, Result) {
+	if l.IsZero() {
+		return arrival, Result{Allowed: true}
+	}
+	emission := l.Period / time.Duration(l.Requests)
+	tolerance := emission * time.Duration(l.burst())
+	if arrival.Before(now) {
+		arrival = now
+	}
+	next := arrival.Add(emission * time.Duration(cost))
+	allowAt := next.Add(-tolerance)
+	if now.Before(allowAt) {
+		result := Result{
+			Limit:      l.burst(),
+			RetryAfter: allowAt.Sub(now),
+			ResetAfter: arrival.Sub(now),
+		}
+		if remaining := (tolerance - arrival.Sub(now)) / emission; remaining > 0 {
+			result.Remaining = uint32(remaining)
+		}
+		return arrival, result
+	}
+	return next, Result{
+		Allowed:    true,
+		Limit:      l.burst(),
+		Remaining:  uint32(now.Sub(allowAt) / emission),
+		ResetAfter: next.Sub(now),
+	}
+}
+
+// Store keeps the state of the buckets. Take must be atomic for all the
+// callers sharing the same store, a distributed store typically runs Apply as
+// a script on the server side.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, cost uint32) (Result, error)
+}
+
+// Limiter applies a single limit to many keys.
+type Limiter struct {
+	store Store
+	limit Limit
+}
+
+func NewLimiter(store Store, limit Limit) *Limiter {
+	if store == nil {
+		panic("BUG: store must not be nil")
+	}
+	return &Limiter{store: store, limit: limit}
+}
+
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow takes a single request from the bucket of the key.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.store.Take(ctx, key, l.limit, 1)
+}
+
+// AllowN takes cost requests from the bucket of the key.
+func (l *Limiter) AllowN(ctx context.Context, key string, cost uint32) (Result, error) {
+	return l.store.Take(ctx, key, l.limit, cost)
+}
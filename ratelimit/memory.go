@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in memory, it is only suitable for a single
+// instance. Full buckets are forgotten periodically.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	buckets map[string]time.Time
+	sweepAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, cost uint32) (Result, error) {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.After(s.sweepAt) {
+		s.sweep(now)
+	}
+	arrival, result := limit.Apply(s.buckets[key], now, cost)
+	if arrival.After(now) {
+		s.buckets[key] = arrival
+	}
+	return result, nil
+}
+
+// sweep forgets the buckets that are full again, they behave as new ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, arrival := range s.buckets {
+		if !arrival.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.sweepAt = now.Add(memorySweepInterval)
+}
@@ -0,0 +1,204 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+const (
+	ErrInvalidCookie = exception.String("Invalid cookie")
+	ErrExpiredCookie = exception.String("Expired cookie")
+)
+
+// secretMinLength is the minimum length of a secret of a SecureCookie.
+const secretMinLength = 32
+
+// SecureCookie signs or encrypts the values of cookies, bound to the cookie
+// name and timestamped. The first secret encodes, all of them decode, so that
+// the secrets can be rotated by prepending the new one and removing the old
+// one once its cookies expired.
+type SecureCookie struct {
+	encrypt bool
+	keys    []secureCookieKey
+}
+
+type secureCookieKey struct {
+	hash  []byte
+	block cipher.AEAD
+}
+
+// NewSignedCookie creates a SecureCookie signing the values with HMAC-SHA256,
+// the values are readable by the client.
+func NewSignedCookie(secrets ...[]byte) *SecureCookie {
+	return newSecureCookie(false, secrets)
+}
+
+// NewEncryptedCookie creates a SecureCookie encrypting the values with
+// AES-256-GCM, the values are neither readable nor modifiable by the client.
+func NewEncryptedCookie(secrets ...[]byte) *SecureCookie {
+	return newSecureCookie(true, secrets)
+}
+
+func newSecureCookie(encrypt bool, secrets [][]byte) *SecureCookie {
+	if len(secrets) == 0 {
+		panic("BUG: SecureCookie needs at least one secret")
+	}
+	cookie := &SecureCookie{encrypt: encrypt}
+	for _, secret := range secrets {
+		if len(secret) < secretMinLength {
+			panic("BUG: SecureCookie secret must be at least 32 bytes")
+		}
+		// distinct keys for the distinct uses of the same secret
+		var key secureCookieKey
+		var err error
+		if encrypt {
+			var blockKey []byte
+			if blockKey, err = hkdf.Key(sha256.New, secret, nil, "cookie encryption", 32); err == nil {
+				key.block, err = newGCM(blockKey)
+			}
+		} else {
+			key.hash, err = hkdf.Key(sha256.New, secret, nil, "cookie signature", 32)
+		}
+		if err != nil {
+			panic("BUG: " + err.Error())
+		}
+		cookie.keys = append(cookie.keys, key)
+	}
+	return cookie
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encode returns the cookie value of a value.
+func (c *SecureCookie) Encode(name string, value []byte) string {
+	// the timestamp is followed by the value
+	payload := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Unix()))
+	payload = append(payload, value...)
+	key := c.keys[0]
+	if c.encrypt {
+		nonce := make([]byte, key.block.NonceSize(), key.block.NonceSize()+len(payload)+key.block.Overhead())
+		_, _ = rand.Read(nonce)
+		return base64.RawURLEncoding.EncodeToString(key.block.Seal(nonce, nonce, payload, []byte(name)))
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, signCookie(key.hash, name, payload)...))
+}
+
+// Decode returns the value of a cookie value encoded by Encode with the same
+// name, no older than the max age unless it is zero.
+func (c *SecureCookie) Decode(name string, encoded string, maxAge time.Duration) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCookie.AddCause(err)
+	}
+	payload, ok := c.open(name, data)
+	if !ok || len(payload) < 8 {
+		return nil, ErrInvalidCookie
+	}
+	timestamp := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if maxAge > 0 && time.Since(timestamp) > maxAge {
+		return nil, ErrExpiredCookie
+	}
+	return payload[8:], nil
+}
+
+// open verifies or decrypts the data with any of the keys.
+func (c *SecureCookie) open(name string, data []byte) ([]byte, bool) {
+	for _, key := range c.keys {
+		if c.encrypt {
+			if len(data) < key.block.NonceSize() {
+				return nil, false
+			}
+			nonce, sealed := data[:key.block.NonceSize()], data[key.block.NonceSize():]
+			if payload, err := key.block.Open(nil, nonce, sealed, []byte(name)); err == nil {
+				return payload, true
+			}
+			continue
+		}
+		if len(data) < sha256.Size {
+			return nil, false
+		}
+		payload, signature := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+		if hmac.Equal(signature, signCookie(key.hash, name, payload)) {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+func signCookie(key []byte, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	// separates the name from the payload
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+//region CookieStore
+
+// cookieMaxSize is the maximum size of a cookie value accepted by browsers,
+// leaving room for the name and the attributes.
+const cookieMaxSize = 4000
+
+// CookieStore keeps the sessions in the cookie itself, encoded by a
+// SecureCookie, typically encrypted. The sessions cannot be revoked before
+// they expire, and their values must be small.
+type CookieStore struct {
+	cookie *SecureCookie
+}
+
+func NewCookieStore(cookie *SecureCookie) *CookieStore {
+	if cookie == nil {
+		panic("BUG: cookie must not be nil")
+	}
+	return &CookieStore{cookie: cookie}
+}
+
+func (s *CookieStore) Load(_ context.Context, value string) (*Data, error) {
+	// the expiration is checked by the manager from the data
+	decoded, err := s.cookie.Decode("session", value, 0)
+	if err != nil {
+		return nil, nil
+	}
+	var data Data
+	if err := json.Unmarshal(decoded, &data); err != nil {
+		return nil, exception.String("Decode session failed").AddCause(err)
+	}
+	return &data, nil
+}
+
+func (s *CookieStore) Save(_ context.Context, data *Data, _ time.Time) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", exception.String("Encode session failed").AddCause(err)
+	}
+	value := s.cookie.Encode("session", encoded)
+	if len(value) > cookieMaxSize {
+		return "", exception.String("Session is too large for a cookie")
+	}
+	return value, nil
+}
+
+// Delete does nothing, the cookie is deleted by the manager.
+func (s *CookieStore) Delete(context.Context, string) error {
+	return nil
+}
+
+//endregion CookieStore
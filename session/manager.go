@@ -0,0 +1,242 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+// Config configures the Manager created by New. The store is either "memory",
+// "postgres" using the *pgxpool.Pool of the application, or "cookie". The
+// first secret signs the cookie of the server-side stores and encrypts the
+// cookie of the cookie store, the others are the previous secrets still
+// accepted. The timeouts are in seconds.
+type Config struct {
+	Store           string   `env:"SESSION_STORE" validate:"oneof=memory postgres cookie"`
+	Secrets         []string `env:"SESSION_SECRETS" validate:"dive,min=32" log:"redact"`
+	CookieName      string   `env:"SESSION_COOKIE_NAME" validate:"required"`
+	CookiePath      string   `env:"SESSION_COOKIE_PATH" validate:"required"`
+	CookieDomain    string   `env:"SESSION_COOKIE_DOMAIN"`
+	CookieSecure    bool     `env:"SESSION_COOKIE_SECURE"`
+	CookieSameSite  string   `env:"SESSION_COOKIE_SAME_SITE" validate:"oneof=lax strict none"`
+	IdleTimeout     uint32   `env:"SESSION_IDLE_TIMEOUT" validate:"min=1"`
+	AbsoluteTimeout uint32   `env:"SESSION_ABSOLUTE_TIMEOUT" validate:"min=1"`
+	PostgresTable   string   `env:"SESSION_POSTGRES_TABLE" validate:"required"`
+}
+
+func init() {
+	configuration.SetDefault("SESSION_STORE", "memory")
+	configuration.SetDefault("SESSION_COOKIE_NAME", "session")
+	configuration.SetDefault("SESSION_COOKIE_PATH", "/")
+	configuration.SetDefault("SESSION_COOKIE_SECURE", "true")
+	configuration.SetDefault("SESSION_COOKIE_SAME_SITE", "lax")
+	configuration.SetDefault("SESSION_IDLE_TIMEOUT", "1800")
+	configuration.SetDefault("SESSION_ABSOLUTE_TIMEOUT", "86400")
+	configuration.SetDefault("SESSION_POSTGRES_TABLE", "sessions")
+}
+
+var sameSites = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+type Params struct {
+	fx.In
+	Config *Config
+	Pool   *pgxpool.Pool `optional:"true"`
+}
+
+// New creates the manager from the config. Give it to http.WithSessions.
+func New(params Params) (*Manager, error) {
+	config := params.Config
+	secrets := make([][]byte, len(config.Secrets))
+	for index, secret := range config.Secrets {
+		secrets[index] = []byte(secret)
+	}
+	options := Options{
+		CookieName:      config.CookieName,
+		CookiePath:      config.CookiePath,
+		CookieDomain:    config.CookieDomain,
+		CookieSecure:    config.CookieSecure,
+		CookieSameSite:  sameSites[config.CookieSameSite],
+		IdleTimeout:     time.Duration(config.IdleTimeout) * time.Second,
+		AbsoluteTimeout: time.Duration(config.AbsoluteTimeout) * time.Second,
+	}
+	switch config.Store {
+	case "postgres":
+		if params.Pool == nil {
+			return nil, exception.String("Postgres session store needs a *pgxpool.Pool")
+		}
+		options.Store = NewPostgresStore(params.Pool, config.PostgresTable)
+	case "cookie":
+		if len(secrets) == 0 {
+			return nil, exception.String("Cookie session store needs SESSION_SECRETS")
+		}
+		options.Store = NewCookieStore(NewEncryptedCookie(secrets...))
+	default:
+		options.Store = NewMemoryStore()
+	}
+	if config.Store != "cookie" && len(secrets) > 0 {
+		options.Cookie = NewSignedCookie(secrets...)
+	}
+	return NewManager(options), nil
+}
+
+//region Manager
+
+// Options configures a Manager. The zero timeouts default to 30 minutes of
+// inactivity and 24 hours since the creation.
+type Options struct {
+	Store Store
+	// Cookie signs or encrypts the cookie value given by the store, or nil to
+	// send it as is.
+	Cookie         *SecureCookie
+	CookieName     string
+	CookiePath     string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	// IdleTimeout expires the sessions not used for this duration.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires the sessions this duration after their creation,
+	// even if they are used.
+	AbsoluteTimeout time.Duration
+}
+
+// touchDivisor limits the saves of the unchanged sessions to refresh their
+// idle timeout, to once per this fraction of the idle timeout.
+const touchDivisor = 10
+
+// Manager loads the session of a request from the cookie, and saves it with
+// the cookie of the response.
+type Manager struct {
+	options Options
+}
+
+func NewManager(options Options) *Manager {
+	if options.Store == nil {
+		panic("BUG: store must not be nil")
+	}
+	if options.CookieName == "" {
+		options.CookieName = "session"
+	}
+	if options.CookiePath == "" {
+		options.CookiePath = "/"
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 30 * time.Minute
+	}
+	if options.AbsoluteTimeout <= 0 {
+		options.AbsoluteTimeout = 24 * time.Hour
+	}
+	return &Manager{options: options}
+}
+
+// Load returns the session of the request, or a new one if the request has no
+// valid session.
+func (m *Manager) Load(request *http.Request) (*Session, error) {
+	ctx := request.Context()
+	now := time.Now()
+	cookie, err := request.Cookie(m.options.CookieName)
+	if err != nil {
+		return newSession(now), nil
+	}
+	session := newSession(now)
+	session.hasCookie = true
+	value := cookie.Value
+	if m.options.Cookie != nil {
+		decoded, err := m.options.Cookie.Decode(m.options.CookieName, value, m.options.AbsoluteTimeout)
+		if err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("Ignored invalid session cookie")
+			return session, nil
+		}
+		value = string(decoded)
+	}
+	data, err := m.options.Store.Load(ctx, value)
+	if err != nil {
+		return nil, exception.String("Load session failed").AddCause(err)
+	}
+	if data == nil {
+		return session, nil
+	}
+	if now.Sub(data.TouchedAt) > m.options.IdleTimeout || now.Sub(data.CreatedAt) > m.options.AbsoluteTimeout {
+		if err := m.options.Store.Delete(ctx, data.ID); err != nil {
+			return nil, exception.String("Delete expired session failed").AddCause(err)
+		}
+		return session, nil
+	}
+	session.data = *data
+	session.isNew = false
+	return session, nil
+}
+
+// Save saves the session and sets its cookie, if it changed or its idle
+// timeout needs a refresh. It must be called before the response is written,
+// and only once.
+func (m *Manager) Save(ctx context.Context, writer http.ResponseWriter, session *Session) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.saved {
+		panic("BUG: session is already saved")
+	}
+	session.saved = true
+	if session.previousID != "" {
+		if err := m.options.Store.Delete(ctx, session.previousID); err != nil {
+			return exception.String("Delete previous session failed").AddCause(err)
+		}
+	}
+	if session.destroyed {
+		if !session.isNew {
+			if err := m.options.Store.Delete(ctx, session.data.ID); err != nil {
+				return exception.String("Delete session failed").AddCause(err)
+			}
+		}
+		if session.hasCookie || !session.isNew {
+			http.SetCookie(writer, m.cookie("", -1))
+		}
+		return nil
+	}
+	now := time.Now()
+	if !session.changed && !session.regenerated &&
+		(session.isNew || now.Sub(session.data.TouchedAt) < m.options.IdleTimeout/touchDivisor) {
+		return nil
+	}
+	session.data.TouchedAt = now
+	expiresAt := now.Add(m.options.IdleTimeout)
+	if absoluteAt := session.data.CreatedAt.Add(m.options.AbsoluteTimeout); absoluteAt.Before(expiresAt) {
+		expiresAt = absoluteAt
+	}
+	value, err := m.options.Store.Save(ctx, &session.data, expiresAt)
+	if err != nil {
+		return exception.String("Save session failed").AddCause(err)
+	}
+	if m.options.Cookie != nil {
+		value = m.options.Cookie.Encode(m.options.CookieName, []byte(value))
+	}
+	http.SetCookie(writer, m.cookie(value, max(int((expiresAt.Sub(now)+time.Second-1)/time.Second), 1)))
+	session.isNew = false
+	return nil
+}
+
+func (m *Manager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.options.CookieName,
+		Value:    value,
+		Path:     m.options.CookiePath,
+		Domain:   m.options.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   m.options.CookieSecure,
+		HttpOnly: true,
+		SameSite: m.options.CookieSameSite,
+	}
+}
+
+//endregion Manager
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps the sessions in memory, it is only suitable for a single
+// instance and the sessions are lost on restart. Expired sessions are
+// forgotten periodically.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	sessions map[string]memorySession
+	sweepAt  time.Time
+}
+
+type memorySession struct {
+	// encoded, so that the stored data is not shared with the requests
+	data      []byte
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]memorySession{}}
+}
+
+func (s *MemoryStore) Load(_ context.Context, id string) (*Data, error) {
+	s.mutex.Lock()
+	stored, exists := s.sessions[id]
+	s.mutex.Unlock()
+	if !exists || !stored.expiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	var data Data
+	if err := json.Unmarshal(stored.data, &data); err != nil {
+		return nil, exception.String("Decode session failed").AddCause(err)
+	}
+	return &data, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, data *Data, expiresAt time.Time) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", exception.String("Encode session failed").AddCause(err)
+	}
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.After(s.sweepAt) {
+		s.sweep(now)
+	}
+	s.sessions[data.ID] = memorySession{data: encoded, expiresAt: expiresAt}
+	return data.ID, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for id, stored := range s.sessions {
+		if !stored.expiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sweepAt = now.Add(memorySweepInterval)
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thanhminhmr/go-exception"
+)
+
+// PostgresStore keeps the sessions in a table of a Postgres database, shared
+// by all the instances. The table is created by CreateTable, and the expired
+// sessions are only deleted by DeleteExpired.
+type PostgresStore struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+// NewPostgresStore creates a store on a table, such as "sessions", which may be
+// qualified by a schema, such as "auth.sessions".
+func NewPostgresStore(pool *pgxpool.Pool, table string) *PostgresStore {
+	if pool == nil {
+		panic("BUG: pool must not be nil")
+	}
+	if table == "" {
+		panic("BUG: table must not be empty")
+	}
+	return &PostgresStore{pool: pool, table: pgx.Identifier(strings.Split(table, ".")).Sanitize()}
+}
+
+// CreateTable creates the table of the sessions if it does not exist.
+func (s *PostgresStore) CreateTable(ctx context.Context) error {
+	if _, err := s.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+	id         TEXT        PRIMARY KEY,
+	data       JSONB       NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+)`); err != nil {
+		return exception.String("Create session table failed").AddCause(err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Load(ctx context.Context, id string) (*Data, error) {
+	var encoded []byte
+	err := s.pool.QueryRow(ctx, `SELECT data FROM `+s.table+` WHERE id = $1 AND expires_at > now()`, id).Scan(&encoded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, exception.String("Load session failed").AddCause(err)
+	}
+	var data Data
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, exception.String("Decode session failed").AddCause(err)
+	}
+	return &data, nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, data *Data, expiresAt time.Time) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", exception.String("Encode session failed").AddCause(err)
+	}
+	if _, err := s.pool.Exec(ctx, `INSERT INTO `+s.table+` (id, data, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at`,
+		data.ID, encoded, expiresAt,
+	); err != nil {
+		return "", exception.String("Save session failed").AddCause(err)
+	}
+	return data.ID, nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.pool.Exec(ctx, `DELETE FROM `+s.table+` WHERE id = $1`, id); err != nil {
+		return exception.String("Delete session failed").AddCause(err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the expired sessions, returning their count. It is
+// meant to be called periodically.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM `+s.table+` WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, exception.String("Delete expired sessions failed").AddCause(err)
+	}
+	return tag.RowsAffected(), nil
+}
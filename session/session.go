@@ -0,0 +1,228 @@
+// Package session manages the server-side sessions of the http package, kept
+// by a Store and referred to by a cookie, or kept in the cookie itself.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// Data is the stored state of a session.
+type Data struct {
+	ID        string                     `json:"id"`
+	Values    map[string]json.RawMessage `json:"values,omitempty"`
+	Csrf      string                     `json:"csrf,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	TouchedAt time.Time                  `json:"touched_at"`
+}
+
+// Store keeps the sessions. A server-side store keys them by ID, which is the
+// cookie value, while the CookieStore keeps them in the cookie value itself.
+type Store interface {
+	// Load returns the data of a cookie value, or nil if there is none.
+	Load(ctx context.Context, value string) (*Data, error)
+	// Save keeps the data until it expires and returns the cookie value.
+	Save(ctx context.Context, data *Data, expiresAt time.Time) (string, error)
+	// Delete forgets the data of a session ID.
+	Delete(ctx context.Context, id string) error
+}
+
+// newID returns a random session ID of 256 bits.
+func newID() string {
+	return randomString(32)
+}
+
+func randomString(size int) string {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+//region Session
+
+// Session is the session of a request, given by SessionFromContext or bound
+// to a *Session field tagged with session by the http package. It is saved
+// before the response is written, so it must not be changed afterward.
+type Session struct {
+	mutex sync.Mutex
+	data  Data
+	// isNew is true until the session is saved
+	isNew bool
+	// hasCookie is true if the request has a session cookie, maybe invalid
+	hasCookie bool
+	// previousID is the ID to delete when saving, after a regeneration
+	previousID  string
+	changed     bool
+	regenerated bool
+	destroyed   bool
+	saved       bool
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{
+		data:  Data{ID: newID(), CreatedAt: now, TouchedAt: now},
+		isNew: true,
+	}
+}
+
+// ID returns the session ID, which must not be disclosed besides the cookie.
+func (s *Session) ID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data.ID
+}
+
+// IsNew reports whether the session was created by the request.
+func (s *Session) IsNew() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isNew
+}
+
+func (s *Session) CreatedAt() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data.CreatedAt
+}
+
+// Get decodes the value of a key into value, returning false if the key is not
+// set.
+func (s *Session) Get(key string, value any) (bool, error) {
+	s.mutex.Lock()
+	raw, exists := s.data.Values[key]
+	s.mutex.Unlock()
+	if !exists {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return true, exception.String("Decode session value failed").AddCause(err)
+	}
+	return true, nil
+}
+
+// Set sets the value of a key, encoded as json.
+func (s *Session) Set(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return exception.String("Encode session value failed").AddCause(err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.data.Values == nil {
+		s.data.Values = map[string]json.RawMessage{}
+	}
+	s.data.Values[key] = raw
+	s.changed = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.data.Values[key]; exists {
+		delete(s.data.Values, key)
+		s.changed = true
+	}
+}
+
+// Clear deletes all the values.
+func (s *Session) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.data.Values) > 0 {
+		s.data.Values = nil
+		s.changed = true
+	}
+}
+
+// Regenerate replaces the session ID and the CSRF token, keeping the values.
+// It must be called when the privileges change, such as on login, so that a
+// session ID known before cannot be used afterward.
+func (s *Session) Regenerate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.isNew && s.previousID == "" {
+		s.previousID = s.data.ID
+	}
+	s.data.ID = newID()
+	s.data.Csrf = ""
+	s.regenerated = true
+}
+
+// Destroy deletes the session and its cookie, such as on logout.
+func (s *Session) Destroy() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Values = nil
+	s.data.Csrf = ""
+	s.destroyed = true
+}
+
+//endregion Session
+
+//region csrf
+
+// csrfSize is the size of the CSRF secret of a session.
+const csrfSize = 32
+
+// CsrfToken returns a CSRF token of the session, to be sent back by the client
+// with the unsafe requests, such as in a hidden form field or a header. The
+// token is masked differently every time, so that it cannot be recovered from
+// compressed responses.
+func (s *Session) CsrfToken() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := base64.RawURLEncoding.DecodeString(s.data.Csrf)
+	if err != nil || len(secret) != csrfSize {
+		s.data.Csrf = randomString(csrfSize)
+		s.changed = true
+		secret, _ = base64.RawURLEncoding.DecodeString(s.data.Csrf)
+	}
+	token := make([]byte, 2*csrfSize)
+	_, _ = rand.Read(token[:csrfSize])
+	subtle.XORBytes(token[csrfSize:], token[:csrfSize], secret)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// VerifyCsrf reports whether a token was returned by CsrfToken of the session.
+func (s *Session) VerifyCsrf(token string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := base64.RawURLEncoding.DecodeString(s.data.Csrf)
+	if err != nil || len(secret) != csrfSize {
+		return false
+	}
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*csrfSize {
+		return false
+	}
+	unmasked := make([]byte, csrfSize)
+	subtle.XORBytes(unmasked, masked[:csrfSize], masked[csrfSize:])
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+//endregion csrf
+
+//region context
+
+type sessionKey struct{}
+
+func ContextWithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFromContext returns the session of a request, or nil if the sessions
+// are not enabled.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+//endregion context
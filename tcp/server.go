@@ -5,8 +5,15 @@ import (
 	"fmt"
 	"math/rand/v2"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+	"github.com/thanhminhmr/go-common/metrics"
+	"github.com/thanhminhmr/go-common/ratelimit"
+	"github.com/thanhminhmr/go-common/tracing"
 
 	"github.com/rs/zerolog"
 	"github.com/thanhminhmr/go-exception"
@@ -17,8 +24,36 @@ type ServerConfig struct {
 	Port               uint16 `env:"TCP_SERVER_PORT" validate:"required"`
 	ShutdownOnError    bool   `env:"TCP_SERVER_SHUTDOWN_ON_ERROR"`
 	TracePerConnection bool   `env:"TCP_SERVER_TRACE_PER_CONNECTION"`
+	// accepted connections per period and per remote ip, zero disables
+	RateLimit       uint32 `env:"TCP_SERVER_RATE_LIMIT"`
+	RateLimitPeriod uint32 `env:"TCP_SERVER_RATE_LIMIT_PERIOD" validate:"min=1,max=86400"`
+	RateLimitBurst  uint32 `env:"TCP_SERVER_RATE_LIMIT_BURST"`
+}
+
+func init() {
+	configuration.SetDefault("TCP_SERVER_RATE_LIMIT", "0")
+	configuration.SetDefault("TCP_SERVER_RATE_LIMIT_PERIOD", "60")
+	configuration.SetDefault("TCP_SERVER_RATE_LIMIT_BURST", "0")
 }
 
+var (
+	serverConnectionsActive = metrics.NewGauge(
+		"tcp_server_connections_active",
+		"Number of tcp connections currently being handled.",
+		"port",
+	)
+	serverConnectionsAccepted = metrics.NewCounter(
+		"tcp_server_connections_accepted_total",
+		"Number of tcp connections accepted and handled.",
+		"port",
+	)
+	serverConnectionsRejected = metrics.NewCounter(
+		"tcp_server_connections_rejected_total",
+		"Number of tcp connections closed by the rate limit without being handled.",
+		"port",
+	)
+)
+
 type ServerHandler interface {
 	Handle(ctx context.Context, conn *net.TCPConn) error
 }
@@ -29,6 +64,8 @@ func (f ServerHandlerFunc) Handle(ctx context.Context, conn *net.TCPConn) error
 	return f(ctx, conn)
 }
 
+// NewServer creates the server, listening once the lifecycle starts. It is
+// meant for fx.Invoke, see New to check its readiness.
 func NewServer(
 	ctx context.Context,
 	lifecycle fx.Lifecycle,
@@ -36,30 +73,58 @@ func NewServer(
 	config *ServerConfig,
 	handler ServerHandler,
 ) {
-	server := tcpServer{
+	New(ctx, lifecycle, shutdown, config, handler)
+}
+
+// New is NewServer returning the server, which is a health.Pinger failing
+// while it is not listening. To check its readiness, provide it and invoke it
+// so that it is created even if nothing else depends on it:
+//
+//	fx.Provide(tcp.New),
+//	fx.Provide(health.AsChecker(func(server *tcp.Server) health.Checker {
+//		return health.Ping("tcp", server)
+//	})),
+//	fx.Invoke(func(*tcp.Server) {}),
+func New(
+	ctx context.Context,
+	lifecycle fx.Lifecycle,
+	shutdown fx.Shutdowner,
+	config *ServerConfig,
+	handler ServerHandler,
+) *Server {
+	server := &Server{
 		ctx:       ctx,
 		shutdown:  shutdown,
 		config:    config,
 		handler:   handler,
 		semaphore: make(chan struct{}, 1024),
 	}
+	if config.RateLimit > 0 {
+		server.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limit{
+			Requests: config.RateLimit,
+			Period:   time.Duration(config.RateLimitPeriod) * time.Second,
+			Burst:    config.RateLimitBurst,
+		})
+	}
 	lifecycle.Append(fx.Hook{
 		OnStart: server.onStart,
 		OnStop:  server.onStop,
 	})
+	return server
 }
 
-type tcpServer struct {
+type Server struct {
 	ctx       context.Context
 	shutdown  fx.Shutdowner
 	config    *ServerConfig
 	handler   ServerHandler
+	limiter   *ratelimit.Limiter
 	semaphore chan struct{}
 	listener  atomic.Pointer[net.TCPListener]
 	waitGroup sync.WaitGroup
 }
 
-func (s *tcpServer) onStart(context.Context) error {
+func (s *Server) onStart(context.Context) error {
 	logger := zerolog.Ctx(s.ctx)
 	// create listener
 	listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: int(s.config.Port)})
@@ -74,7 +139,15 @@ func (s *tcpServer) onStart(context.Context) error {
 	return nil
 }
 
-func (s *tcpServer) halt(unexpected bool) {
+// Ping fails while the server is not listening.
+func (s *Server) Ping(context.Context) error {
+	if s.listener.Load() == nil {
+		return exception.String("Listener is not running")
+	}
+	return nil
+}
+
+func (s *Server) halt(unexpected bool) {
 	if listener := s.listener.Swap(nil); listener != nil {
 		logger := zerolog.Ctx(s.ctx)
 		if err := listener.Close(); err != nil {
@@ -89,32 +162,80 @@ func (s *tcpServer) halt(unexpected bool) {
 	}
 }
 
-func (s *tcpServer) worker() {
+func (s *Server) worker() {
 	defer s.halt(true)
 	logger := zerolog.Ctx(s.ctx)
 	listener := s.listener.Load()
+	port := strconv.Itoa(int(s.config.Port))
 	for {
-		// acquiring a slot in the semaphore, blocking while full
+		// acquiring a slot in the semaphore before accepting, blocking while full
 		select {
 		case <-s.ctx.Done():
 			logger.Error().Err(s.ctx.Err()).Msg("Stop accepting connection")
 			return
 		case s.semaphore <- struct{}{}:
 		}
-		// accept a connection and execute the connection handler
-		if connection, err := listener.AcceptTCP(); err == nil {
-			go s.execute(connection)
+		// accept a connection
+		connection, err := listener.AcceptTCP()
+		if err != nil {
+			<-s.semaphore
+			if s.listener.Load() != nil {
+				logger.Error().Err(err).Msg("Failed to accept connection")
+			}
+			return
+		}
+		// the rejected connections are not counted as accepted
+		if !s.allow(connection) {
+			<-s.semaphore
+			s.reject(connection, port)
 			continue
-		} else if s.listener.Load() != nil {
-			logger.Error().Err(err).Msg("Failed to accept connection")
 		}
-		break
+		serverConnectionsAccepted.With(port).Inc()
+		// execute the connection handler
+		s.waitGroup.Add(1)
+		go s.execute(connection, port)
+	}
+}
+
+// allow applies the rate limit of the remote ip, failing open.
+func (s *Server) allow(connection *net.TCPConn) bool {
+	if s.limiter == nil {
+		return true
+	}
+	address, ok := connection.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	result, err := s.limiter.Allow(s.ctx, address.IP.String())
+	if err != nil {
+		zerolog.Ctx(s.ctx).Error().Err(err).Msg("Failed to apply rate limit")
+		return true
+	}
+	if !result.Allowed && s.config.TracePerConnection {
+		zerolog.Ctx(s.ctx).Trace().
+			Stringer("remote_address", address).
+			Dur("retry_after", result.RetryAfter).
+			Msg("Rate limited connection")
+	}
+	return result.Allowed
+}
+
+func (s *Server) reject(connection *net.TCPConn, port string) {
+	serverConnectionsRejected.With(port).Inc()
+	if err := connection.Close(); err != nil {
+		zerolog.Ctx(s.ctx).Error().Err(err).Msg("Failed to close rejected connection")
 	}
 }
 
-func (s *tcpServer) execute(connection *net.TCPConn) {
-	s.waitGroup.Add(1)
-	logger := zerolog.Ctx(s.ctx).With().Str("connection_id", fmt.Sprintf("%016x", rand.Uint64())).Logger()
+func (s *Server) execute(connection *net.TCPConn, port string) {
+	serverConnectionsActive.With(port).Inc()
+	ctx, span := tracing.Start(s.ctx, "tcp.connection", tracing.SpanKindServer)
+	span.SetAttribute("network.peer.address", connection.RemoteAddr().String())
+	span.SetAttribute("network.local.address", connection.LocalAddr().String())
+	logger := zerolog.Ctx(s.ctx).With().
+		Str("connection_id", fmt.Sprintf("%016x", rand.Uint64())).
+		EmbedObject(span.SpanContext()).
+		Logger()
 	if s.config.TracePerConnection {
 		logger.Trace().
 			Stringer("remote_address", connection.RemoteAddr()).
@@ -124,7 +245,10 @@ func (s *tcpServer) execute(connection *net.TCPConn) {
 	defer func() {
 		if recovered := exception.Recover(recover()); recovered != nil {
 			logger.Error().Any("recovered", recovered).Msg("Panic while handling connection")
+			span.RecordError(recovered)
 		}
+		span.End()
+		serverConnectionsActive.With(port).Dec()
 		s.waitGroup.Done()
 		<-s.semaphore
 		if s.config.TracePerConnection {
@@ -139,12 +263,13 @@ func (s *tcpServer) execute(connection *net.TCPConn) {
 			logger.Error().Err(err).Msg("Failed to close connection")
 		}
 	}()
-	if err := s.handler.Handle(logger.WithContext(s.ctx), connection); err != nil {
+	if err := s.handler.Handle(logger.WithContext(ctx), connection); err != nil {
 		logger.Error().Err(err).Msg("Error handling connection")
+		span.RecordError(err)
 	}
 }
 
-func (s *tcpServer) onStop(ctx context.Context) error {
+func (s *Server) onStop(ctx context.Context) error {
 	s.halt(false)
 	zerolog.Ctx(s.ctx).Info().Uint16("port", s.config.Port).Msg("Stop listening")
 	// waiting for connection to finish
@@ -0,0 +1,306 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thanhminhmr/go-exception"
+)
+
+// Exporter sends finished spans somewhere. The spans slice is reused after
+// Export returns, so implementations must not retain it.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// NewExporter creates the exporter selected by Config.Exporter.
+func NewExporter(config *Config) (Exporter, error) {
+	switch config.Exporter {
+	case "", "none":
+		return noopExporter{}, nil
+	case "stdout":
+		return NewStdoutExporter(os.Stdout), nil
+	case "otlp":
+		return NewOtlpExporter(config)
+	default:
+		return nil, exception.String("Unknown trace exporter: " + config.Exporter)
+	}
+}
+
+type noopExporter struct{}
+
+func (noopExporter) Export(context.Context, []SpanData) error { return nil }
+
+func (noopExporter) Shutdown(context.Context) error { return nil }
+
+//region InMemoryExporter
+
+// InMemoryExporter keeps every exported span, for use in tests.
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *InMemoryExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// Spans returns a copy of every span exported so far.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return slices.Clone(e.spans)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+//endregion InMemoryExporter
+
+//region StdoutExporter
+
+// StdoutExporter writes each span as a line of JSON.
+type StdoutExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func NewStdoutExporter(writer io.Writer) *StdoutExporter {
+	return &StdoutExporter{writer: writer}
+}
+
+type stdoutSpan struct {
+	Name          string         `json:"name"`
+	Kind          SpanKind       `json:"kind"`
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	TraceState    string         `json:"trace_state,omitempty"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Duration      string         `json:"duration"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	StatusCode    StatusCode     `json:"status_code"`
+	StatusMessage string         `json:"status_message,omitempty"`
+}
+
+func (e *StdoutExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	encoder := json.NewEncoder(e.writer)
+	for _, span := range spans {
+		output := stdoutSpan{
+			Name:          span.Name,
+			Kind:          span.Kind,
+			TraceID:       span.SpanContext.TraceID.String(),
+			SpanID:        span.SpanContext.SpanID.String(),
+			TraceState:    span.SpanContext.TraceState,
+			Start:         span.Start,
+			End:           span.End,
+			Duration:      span.End.Sub(span.Start).String(),
+			Attributes:    span.Attributes,
+			StatusCode:    span.StatusCode,
+			StatusMessage: span.StatusMessage,
+		}
+		if span.Parent.IsValid() {
+			output.ParentSpanID = span.Parent.SpanID.String()
+		}
+		if err := encoder.Encode(output); err != nil {
+			return exception.String("Write span failed").AddCause(err)
+		}
+	}
+	return nil
+}
+
+func (e *StdoutExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+//endregion StdoutExporter
+
+//region OtlpExporter
+
+// OtlpExporter sends spans to an OTLP/HTTP collector using the JSON encoding.
+type OtlpExporter struct {
+	client      *http.Client
+	endpoint    string
+	headers     http.Header
+	serviceName string
+}
+
+func NewOtlpExporter(config *Config) (*OtlpExporter, error) {
+	headers := http.Header{}
+	for _, header := range config.OtlpHeaders {
+		key, value, found := strings.Cut(header, "=")
+		if !found {
+			return nil, exception.String("Invalid OTLP header, expecting key=value: " + header)
+		}
+		headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return &OtlpExporter{
+		client:      &http.Client{Timeout: time.Duration(config.OtlpTimeout) * time.Second},
+		endpoint:    config.OtlpEndpoint,
+		headers:     headers,
+		serviceName: config.ServiceName,
+	}, nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func otlpValue(value any) map[string]any {
+	switch typed := value.(type) {
+	case string:
+		return map[string]any{"stringValue": typed}
+	case bool:
+		return map[string]any{"boolValue": typed}
+	case int:
+		return map[string]any{"intValue": strconv.FormatInt(int64(typed), 10)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(typed, 10)}
+	case uint16:
+		return map[string]any{"intValue": strconv.FormatUint(uint64(typed), 10)}
+	case float64:
+		return map[string]any{"doubleValue": typed}
+	case fmt.Stringer:
+		return map[string]any{"stringValue": typed.String()}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(typed)}
+	}
+}
+
+func otlpAttributes(attributes map[string]any) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	output := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		output = append(output, otlpAttribute{Key: key, Value: otlpValue(attributes[key])})
+	}
+	return output
+}
+
+func (e *OtlpExporter) Export(ctx context.Context, spans []SpanData) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		output := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			TraceState:        span.SpanContext.TraceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.StatusCode, Message: span.StatusMessage},
+		}
+		if span.Parent.IsValid() {
+			output.ParentSpanID = span.Parent.SpanID.String()
+		}
+		converted = append(converted, output)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": e.serviceName})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/thanhminhmr/go-common/tracing"},
+			Spans: converted,
+		}},
+	}}})
+	if err != nil {
+		return exception.String("Encode spans failed").AddCause(err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return exception.String("Create request failed").AddCause(err)
+	}
+	for key, values := range e.headers {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := e.client.Do(request)
+	if err != nil {
+		return exception.String("Send spans failed").AddCause(err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return exception.String("Collector responded with status " + response.Status)
+	}
+	return nil
+}
+
+func (e *OtlpExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+//endregion OtlpExporter
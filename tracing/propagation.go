@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "Traceparent"
+	HeaderTraceState  = "Tracestate"
+)
+
+// ParseTraceParent parses a W3C traceparent header value.
+func ParseTraceParent(value string) (SpanContext, bool) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, false
+	}
+	if !isLowerHex(value[:2]) || value[:2] == "ff" {
+		return SpanContext{}, false
+	}
+	// version 00 has a fixed length, future versions may append fields
+	if value[:2] == "00" && len(value) != 55 || len(value) > 55 && value[55] != '-' {
+		return SpanContext{}, false
+	}
+	var spanContext SpanContext
+	if !decodeHex(spanContext.TraceID[:], value[3:35]) ||
+		!decodeHex(spanContext.SpanID[:], value[36:52]) {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if !decodeHex(flags[:], value[53:55]) {
+		return SpanContext{}, false
+	}
+	spanContext.Flags = flags[0]
+	spanContext.Remote = true
+	if !spanContext.IsValid() {
+		return SpanContext{}, false
+	}
+	return spanContext, true
+}
+
+// FormatTraceParent formats the span context as a W3C traceparent header value.
+func FormatTraceParent(spanContext SpanContext) string {
+	return "00-" + spanContext.TraceID.String() + "-" + spanContext.SpanID.String() + "-" +
+		hex.EncodeToString([]byte{spanContext.Flags & FlagSampled})
+}
+
+// Extract reads the remote span context from incoming headers.
+func Extract(header http.Header) (SpanContext, bool) {
+	spanContext, ok := ParseTraceParent(strings.TrimSpace(header.Get(HeaderTraceParent)))
+	if !ok {
+		return SpanContext{}, false
+	}
+	// multiple tracestate headers are combined as a single list
+	spanContext.TraceState = strings.Join(header.Values(HeaderTraceState), ",")
+	return spanContext, true
+}
+
+// Inject writes the span context in ctx into outgoing headers.
+func Inject(ctx context.Context, header http.Header) {
+	spanContext := SpanFromContext(ctx).SpanContext()
+	if !spanContext.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceParent, FormatTraceParent(spanContext))
+	if spanContext.TraceState != "" {
+		header.Set(HeaderTraceState, spanContext.TraceState)
+	} else {
+		header.Del(HeaderTraceState)
+	}
+}
+
+func isLowerHex(value string) bool {
+	for index := range len(value) {
+		if c := value[index]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeHex(output []byte, input string) bool {
+	if !isLowerHex(input) {
+		return false
+	}
+	_, err := hex.Decode(output, []byte(input))
+	return err == nil
+}
@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that is propagated across process
+// boundaries, as described by the W3C Trace Context specification.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+func (c SpanContext) IsSampled() bool {
+	return c.Flags&FlagSampled != 0
+}
+
+func (c SpanContext) MarshalZerologObject(event *zerolog.Event) {
+	if c.IsValid() {
+		event.Stringer("trace_id", c.TraceID).Stringer("span_id", c.SpanID)
+	}
+}
+
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol.
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+type StatusCode int
+
+// Status codes, numbered as in the OTLP protocol.
+const (
+	StatusUnset StatusCode = iota
+	StatusOk
+	StatusError
+)
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span is an operation in progress. All methods are safe to call on a nil Span.
+type Span struct {
+	tracer *Tracer
+	mutex  sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName renames the span, useful when the name is only known at the end, such
+// as the matched route of a request.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]any{}
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.StatusCode = code
+	s.data.StatusMessage = message
+}
+
+// RecordError marks the span as failed if err is not nil.
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End finishes the span and hands it to the exporter if it is sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mutex.Unlock()
+	if s.tracer != nil && data.SpanContext.IsSampled() {
+		s.tracer.enqueue(data)
+	}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote returns a copy of ctx carrying a remote parent, usually
+// extracted from incoming headers.
+func ContextWithRemote(ctx context.Context, remote SpanContext) context.Context {
+	return ContextWithSpan(ctx, &Span{data: SpanData{SpanContext: remote}, ended: true})
+}
+
+// Start creates a span as a child of the span in ctx, using the default tracer.
+// The span context is always generated, so that its IDs can be logged even when
+// no tracer is configured.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	tracer := defaultTracer.Load()
+	parent := SpanFromContext(ctx).SpanContext()
+	spanContext := SpanContext{
+		TraceID:    parent.TraceID,
+		SpanID:     newSpanID(),
+		Flags:      parent.Flags,
+		TraceState: parent.TraceState,
+	}
+	if !parent.IsValid() {
+		spanContext.TraceID = newTraceID()
+		spanContext.Flags = 0
+		if tracer.sample() {
+			spanContext.Flags = FlagSampled
+		}
+	}
+	span := &Span{
+		tracer: tracer,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: spanContext,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		high, low := rand.Uint64(), rand.Uint64()
+		for index := range 8 {
+			id[index] = byte(high >> (56 - 8*index))
+			id[index+8] = byte(low >> (56 - 8*index))
+		}
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		value := rand.Uint64()
+		for index := range 8 {
+			id[index] = byte(value >> (56 - 8*index))
+		}
+	}
+	return id
+}
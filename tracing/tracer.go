@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/thanhminhmr/go-common/configuration"
+
+	"github.com/rs/zerolog"
+	"github.com/thanhminhmr/go-exception"
+	"go.uber.org/fx"
+)
+
+type Config struct {
+	ServiceName   string   `env:"TRACE_SERVICE_NAME" validate:"required"`
+	Exporter      string   `env:"TRACE_EXPORTER" validate:"oneof=none stdout otlp"`
+	OtlpEndpoint  string   `env:"TRACE_OTLP_ENDPOINT" validate:"required_if=Exporter otlp,omitempty,url"`
+	OtlpHeaders   []string `env:"TRACE_OTLP_HEADERS"`
+	OtlpTimeout   uint32   `env:"TRACE_OTLP_TIMEOUT" validate:"min=1,max=60"`
+	SampleRatio   float64  `env:"TRACE_SAMPLE_RATIO" validate:"min=0,max=1"`
+	QueueSize     uint32   `env:"TRACE_QUEUE_SIZE" validate:"min=1"`
+	BatchSize     uint32   `env:"TRACE_BATCH_SIZE" validate:"min=1"`
+	FlushInterval uint32   `env:"TRACE_FLUSH_INTERVAL" validate:"min=1,max=60"`
+}
+
+func init() {
+	configuration.SetDefault("TRACE_SERVICE_NAME", "unknown_service")
+	configuration.SetDefault("TRACE_EXPORTER", "none")
+	configuration.SetDefault("TRACE_OTLP_ENDPOINT", "http://localhost:4318/v1/traces")
+	configuration.SetDefault("TRACE_OTLP_TIMEOUT", "10")
+	configuration.SetDefault("TRACE_SAMPLE_RATIO", "1")
+	configuration.SetDefault("TRACE_QUEUE_SIZE", "2048")
+	configuration.SetDefault("TRACE_BATCH_SIZE", "512")
+	configuration.SetDefault("TRACE_FLUSH_INTERVAL", "5")
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// Tracer batches sampled spans and hands them to the exporter. Spans started
+// before any Tracer is created are never exported.
+type Tracer struct {
+	ctx      context.Context
+	config   *Config
+	exporter Exporter
+	queue    chan SpanData
+	stop     chan struct{}
+	done     chan struct{}
+	dropped  atomic.Uint64
+}
+
+// NewTracer creates the tracer and installs it as the default one used by Start.
+func NewTracer(
+	ctx context.Context,
+	lifecycle fx.Lifecycle,
+	config *Config,
+	exporter Exporter,
+) *Tracer {
+	tracer := &Tracer{
+		ctx:      ctx,
+		config:   config,
+		exporter: exporter,
+		queue:    make(chan SpanData, config.QueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	lifecycle.Append(fx.Hook{
+		OnStart: tracer.onStart,
+		OnStop:  tracer.onStop,
+	})
+	return tracer
+}
+
+func (t *Tracer) onStart(context.Context) error {
+	defaultTracer.Store(t)
+	go t.worker()
+	return nil
+}
+
+func (t *Tracer) onStop(ctx context.Context) error {
+	defaultTracer.CompareAndSwap(t, nil)
+	close(t.stop)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+	if dropped := t.dropped.Load(); dropped > 0 {
+		zerolog.Ctx(t.ctx).Warn().Uint64("dropped", dropped).Msg("Spans dropped because the queue was full")
+	}
+	if err := t.exporter.Shutdown(ctx); err != nil {
+		zerolog.Ctx(t.ctx).Error().Err(err).Msg("Failed to shutdown exporter")
+		return err
+	}
+	return nil
+}
+
+func (t *Tracer) sample() bool {
+	if t == nil {
+		return false
+	}
+	return t.config.SampleRatio >= 1 || rand.Float64() < t.config.SampleRatio
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) worker() {
+	defer close(t.done)
+	ticker := time.NewTicker(time.Duration(t.config.FlushInterval) * time.Second)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, t.config.BatchSize)
+	for {
+		select {
+		case data := <-t.queue:
+			if batch = append(batch, data); len(batch) >= int(t.config.BatchSize) {
+				batch = t.export(batch)
+			}
+		case <-ticker.C:
+			batch = t.export(batch)
+		case <-t.stop:
+			// drain whatever is left in the queue
+			for {
+				select {
+				case data := <-t.queue:
+					if batch = append(batch, data); len(batch) >= int(t.config.BatchSize) {
+						batch = t.export(batch)
+					}
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) export(batch []SpanData) []SpanData {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(t.ctx), time.Duration(t.config.OtlpTimeout)*time.Second)
+	defer cancel()
+	if err := t.safeExport(ctx, batch); err != nil {
+		zerolog.Ctx(t.ctx).Error().Err(err).Int("spans", len(batch)).Msg("Failed to export spans")
+	}
+	return batch[:0]
+}
+
+func (t *Tracer) safeExport(ctx context.Context, batch []SpanData) (err error) {
+	defer func() {
+		if recovered := exception.Recover(recover()); recovered != nil {
+			err = recovered
+		}
+	}()
+	return t.exporter.Export(ctx, batch)
+}
@@ -0,0 +1,253 @@
+package validation
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/ar"
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fa"
+	"github.com/go-playground/locales/fr"
+	"github.com/go-playground/locales/id"
+	"github.com/go-playground/locales/it"
+	"github.com/go-playground/locales/ja"
+	"github.com/go-playground/locales/ko"
+	"github.com/go-playground/locales/lv"
+	"github.com/go-playground/locales/nl"
+	"github.com/go-playground/locales/pl"
+	"github.com/go-playground/locales/pt"
+	"github.com/go-playground/locales/pt_BR"
+	"github.com/go-playground/locales/ru"
+	"github.com/go-playground/locales/th"
+	"github.com/go-playground/locales/tr"
+	"github.com/go-playground/locales/uk"
+	"github.com/go-playground/locales/vi"
+	"github.com/go-playground/locales/zh"
+	"github.com/go-playground/locales/zh_Hant_TW"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	artranslations "github.com/go-playground/validator/v10/translations/ar"
+	detranslations "github.com/go-playground/validator/v10/translations/de"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	estranslations "github.com/go-playground/validator/v10/translations/es"
+	fatranslations "github.com/go-playground/validator/v10/translations/fa"
+	frtranslations "github.com/go-playground/validator/v10/translations/fr"
+	idtranslations "github.com/go-playground/validator/v10/translations/id"
+	ittranslations "github.com/go-playground/validator/v10/translations/it"
+	jatranslations "github.com/go-playground/validator/v10/translations/ja"
+	kotranslations "github.com/go-playground/validator/v10/translations/ko"
+	lvtranslations "github.com/go-playground/validator/v10/translations/lv"
+	nltranslations "github.com/go-playground/validator/v10/translations/nl"
+	pltranslations "github.com/go-playground/validator/v10/translations/pl"
+	pttranslations "github.com/go-playground/validator/v10/translations/pt"
+	ptbrtranslations "github.com/go-playground/validator/v10/translations/pt_BR"
+	rutranslations "github.com/go-playground/validator/v10/translations/ru"
+	thtranslations "github.com/go-playground/validator/v10/translations/th"
+	trtranslations "github.com/go-playground/validator/v10/translations/tr"
+	uktranslations "github.com/go-playground/validator/v10/translations/uk"
+	vitranslations "github.com/go-playground/validator/v10/translations/vi"
+	zhtranslations "github.com/go-playground/validator/v10/translations/zh"
+	zhtwtranslations "github.com/go-playground/validator/v10/translations/zh_tw"
+)
+
+// DefaultLanguage is used when none of the accepted languages is supported.
+const DefaultLanguage = "en"
+
+// FieldError is the message of an invalid field, in a language.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// FieldErrors are the errors of several fields, such as returned by the
+// Validate hook of a request.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for index, fieldError := range e {
+		messages[index] = fieldError.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+//region languages
+
+type language struct {
+	locale   func() locales.Translator
+	register func(validate *validator.Validate, translator ut.Translator) error
+	once     sync.Once
+	// translator is nil if the registration failed
+	translator ut.Translator
+}
+
+// languages are keyed by lowercase language tag, such as "pt-br".
+var languages = map[string]*language{
+	"ar":    {locale: ar.New, register: artranslations.RegisterDefaultTranslations},
+	"de":    {locale: de.New, register: detranslations.RegisterDefaultTranslations},
+	"en":    {locale: en.New, register: entranslations.RegisterDefaultTranslations},
+	"es":    {locale: es.New, register: estranslations.RegisterDefaultTranslations},
+	"fa":    {locale: fa.New, register: fatranslations.RegisterDefaultTranslations},
+	"fr":    {locale: fr.New, register: frtranslations.RegisterDefaultTranslations},
+	"id":    {locale: id.New, register: idtranslations.RegisterDefaultTranslations},
+	"it":    {locale: it.New, register: ittranslations.RegisterDefaultTranslations},
+	"ja":    {locale: ja.New, register: jatranslations.RegisterDefaultTranslations},
+	"ko":    {locale: ko.New, register: kotranslations.RegisterDefaultTranslations},
+	"lv":    {locale: lv.New, register: lvtranslations.RegisterDefaultTranslations},
+	"nl":    {locale: nl.New, register: nltranslations.RegisterDefaultTranslations},
+	"pl":    {locale: pl.New, register: pltranslations.RegisterDefaultTranslations},
+	"pt":    {locale: pt.New, register: pttranslations.RegisterDefaultTranslations},
+	"pt-br": {locale: pt_BR.New, register: ptbrtranslations.RegisterDefaultTranslations},
+	"ru":    {locale: ru.New, register: rutranslations.RegisterDefaultTranslations},
+	"th":    {locale: th.New, register: thtranslations.RegisterDefaultTranslations},
+	"tr":    {locale: tr.New, register: trtranslations.RegisterDefaultTranslations},
+	"uk":    {locale: uk.New, register: uktranslations.RegisterDefaultTranslations},
+	"vi":    {locale: vi.New, register: vitranslations.RegisterDefaultTranslations},
+	"zh":    {locale: zh.New, register: zhtranslations.RegisterDefaultTranslations},
+	"zh-tw": {locale: zh_Hant_TW.New, register: zhtwtranslations.RegisterDefaultTranslations},
+}
+
+// translationsMutex guards the translations of the validator, registered
+// lazily while other errors may be translated.
+var translationsMutex sync.RWMutex
+
+// translatorOf registers the translations of the language on first use.
+func (l *language) translatorOf() ut.Translator {
+	l.once.Do(func() {
+		translationsMutex.Lock()
+		defer translationsMutex.Unlock()
+		locale := l.locale()
+		translator, _ := ut.New(locale, locale).GetTranslator(locale.Locale())
+		if err := l.register(validate, translator); err == nil {
+			l.translator = translator
+		}
+	})
+	return l.translator
+}
+
+// negotiateLanguage returns the supported language preferred by an
+// Accept-Language header, such as "fr-CH, fr;q=0.9, en;q=0.8".
+func negotiateLanguage(acceptLanguage string) string {
+	type accepted struct {
+		tag     string
+		quality float64
+	}
+	var tags []accepted
+	for part := range strings.SplitSeq(acceptLanguage, ",") {
+		tag, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(parameters), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")); tag != "" && quality > 0 {
+			tags = append(tags, accepted{tag: tag, quality: quality})
+		}
+	}
+	// stable, so that the header order breaks the ties
+	slices.SortStableFunc(tags, func(a accepted, b accepted) int {
+		switch {
+		case a.quality > b.quality:
+			return -1
+		case a.quality < b.quality:
+			return 1
+		default:
+			return 0
+		}
+	})
+	for _, accepted := range tags {
+		// try the tag, then its prefixes, such as "zh-hant-tw", "zh-hant", "zh"
+		for tag := accepted.tag; tag != ""; {
+			if _, exists := languages[tag]; exists {
+				return tag
+			}
+			index := strings.LastIndexByte(tag, '-')
+			if index < 0 {
+				break
+			}
+			tag = tag[:index]
+		}
+	}
+	return DefaultLanguage
+}
+
+//endregion languages
+
+//region custom translations
+
+var (
+	customMutex        sync.RWMutex
+	customTranslations = map[string]map[string]string{}
+)
+
+// RegisterTranslation registers the message of a validation tag in a
+// language, such as "en" or "pt-BR". The message may refer to the field with
+// {0} and to the parameter of the tag with {1}. The messages in DefaultLanguage
+// are used for the languages without one.
+func RegisterTranslation(tag string, language string, message string) {
+	language = strings.ToLower(strings.ReplaceAll(language, "_", "-"))
+	customMutex.Lock()
+	defer customMutex.Unlock()
+	if customTranslations[language] == nil {
+		customTranslations[language] = map[string]string{}
+	}
+	customTranslations[language][tag] = message
+}
+
+func customTranslation(language string, tag string) (string, bool) {
+	customMutex.RLock()
+	defer customMutex.RUnlock()
+	if message, exists := customTranslations[language][tag]; exists {
+		return message, true
+	}
+	message, exists := customTranslations[DefaultLanguage][tag]
+	return message, exists
+}
+
+//endregion custom translations
+
+// Translate returns the messages of the validation errors in the language
+// preferred by an Accept-Language header, or nil if the error is not a
+// validation error. The fields are named by their path from the validated
+// struct, using their tag names.
+func Translate(err error, acceptLanguage string) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	tag := negotiateLanguage(acceptLanguage)
+	translator := languages[tag].translatorOf()
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	translationsMutex.RLock()
+	defer translationsMutex.RUnlock()
+	for _, fieldError := range validationErrors {
+		field := fieldError.Namespace()
+		// drop the name of the validated struct
+		if _, path, found := strings.Cut(field, "."); found {
+			field = path
+		}
+		var message string
+		if custom, exists := customTranslation(tag, fieldError.Tag()); exists {
+			message = strings.NewReplacer("{0}", fieldError.Field(), "{1}", fieldError.Param()).Replace(custom)
+		} else if translator != nil {
+			message = fieldError.Translate(translator)
+		}
+		// the tags without translation are translated to the raw validator error
+		if message == "" || message == fieldError.Error() {
+			message = fieldError.Field() + " failed on the " + strconv.Quote(fieldError.Tag()) + " validation"
+		}
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Message: message})
+	}
+	return fieldErrors
+}
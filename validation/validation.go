@@ -0,0 +1,67 @@
+// Package validation holds the validator shared by configuration.Load and the
+// request parser of the http package, with the custom validations registered
+// to it and the translations of its errors.
+package validation
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidate()
+
+func newValidate() *validator.Validate {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(fieldName)
+	return validate
+}
+
+// nameTags are the tags naming a field in the errors, by priority.
+var nameTags = []string{"env", "json", "xml", "query", "header", "cookie", "url", "form", "multipart"}
+
+// fieldName names a field by its first tag, so that the errors speak of the
+// environment variables and the request fields instead of the Go fields.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range nameTags {
+		if value, exists := field.Tag.Lookup(tag); exists {
+			if name, _, _ := strings.Cut(value, ","); name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// RegisterValidation registers a validation tag. The validations must be
+// registered before validating, such as in an init function.
+func RegisterValidation(tag string, validation validator.Func, callValidationEvenIfNull ...bool) {
+	if err := validate.RegisterValidation(tag, validation, callValidationEvenIfNull...); err != nil {
+		panic("BUG: " + err.Error())
+	}
+}
+
+// RegisterStructValidation registers a validation of the whole struct for the
+// types, reporting its errors with StructLevel.ReportError.
+func RegisterStructValidation(validation validator.StructLevelFunc, types ...any) {
+	validate.RegisterStructValidation(validation, types...)
+}
+
+// RegisterAlias registers a tag standing for other tags, such as "iscolor" for
+// "hexcolor|rgb|rgba|hsl|hsla".
+func RegisterAlias(alias string, tags string) {
+	validate.RegisterAlias(alias, tags)
+}
+
+// Struct validates a struct with its validate tags.
+func Struct(value any) error {
+	return validate.Struct(value)
+}
+
+// StructCtx validates a struct with its validate tags, passing the context to
+// the validations registered with validator.FuncCtx.
+func StructCtx(ctx context.Context, value any) error {
+	return validate.StructCtx(ctx, value)
+}